@@ -0,0 +1,174 @@
+package gocache
+
+import (
+	"context"
+	"crypto/subtle"
+	"path"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Permission 是对某个group的操作权限 可以按位组合
+type Permission uint8
+
+const (
+	PermRead  Permission = 1 << iota // Get BatchGet
+	PermWrite                        // Set Delete
+	PermAdmin                        // Stats
+	PermAll   = PermRead | PermWrite | PermAdmin
+)
+
+// 所有group
+const AnyGroup = "*"
+
+// 每个rpc方法需要的权限
+var methodPermissions = map[string]Permission{
+	"Get":      PermRead,
+	"BatchGet": PermRead,
+	"Set":      PermWrite,
+	"Delete":   PermWrite,
+	"Stats":    PermAdmin,
+}
+
+// ACL 记录每个身份对每个group拥有的权限 可以并发使用
+type ACL struct {
+	mu    sync.RWMutex
+	rules map[string]map[string]Permission // 身份 -> group -> 权限
+}
+
+func NewACL() *ACL {
+	return &ACL{rules: make(map[string]map[string]Permission)}
+}
+
+// Allow 授予identity对group的perm权限 group为 AnyGroup 时对所有group生效
+func (a *ACL) Allow(identity, group string, perm Permission) *ACL {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rules[identity] == nil {
+		a.rules[identity] = make(map[string]Permission)
+	}
+	a.rules[identity][group] |= perm
+	return a
+}
+
+// Revoke 收回identity对group的perm权限
+func (a *ACL) Revoke(identity, group string, perm Permission) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if groups, ok := a.rules[identity]; ok {
+		groups[group] &^= perm
+	}
+}
+
+// Allowed 判断identity是否拥有对group的perm权限
+func (a *ACL) Allowed(identity, group string, perm Permission) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	groups := a.rules[identity]
+	return (groups[group]|groups[AnyGroup])&perm == perm
+}
+
+// AuthConfig 是rpc服务的认证和授权配置
+// 请求方的身份优先从 authorization: Bearer <token> 元数据中的令牌得到 其次是mTLS客户端证书的CommonName
+type AuthConfig struct {
+	Tokens    map[string]string // 令牌 -> 身份
+	MutualTLS bool              // 为true时使用客户端证书的CommonName作为身份 需要同时启用mTLS
+	ACL       *ACL              // 为nil时通过认证的身份拥有所有权限
+	// 本节点访问其他节点时携带的令牌 其他节点需要授予该令牌对应的身份所有group的读写和管理权限
+	// 令牌以明文传输 需要同时启用TLS 否则创建server时返回错误
+	PeerToken string
+	// 为true时允许在没有TLS的连接上发送 PeerToken 仅用于测试和可信网络
+	InsecurePeerToken bool
+}
+
+type identityKey struct{}
+
+// IdentityFromContext 返回通过认证的请求方身份
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// 返回认证和授权的grpc拦截器
+func (a *AuthConfig) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, ok := a.authenticate(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+		}
+		if a.ACL != nil {
+			method := path.Base(info.FullMethod)
+			perm, known := methodPermissions[method]
+			group := ""
+			if r, ok := req.(interface{ GetGroup() string }); ok {
+				group = r.GetGroup()
+			}
+			if !known || !a.ACL.Allowed(identity, group, perm) {
+				return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s on group %s", identity, method, group)
+			}
+		}
+		return handler(context.WithValue(ctx, identityKey{}, identity), req)
+	}
+}
+
+// 从令牌或客户端证书得到请求方的身份
+func (a *AuthConfig) authenticate(ctx context.Context) (string, bool) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			token, ok := strings.CutPrefix(v, "Bearer ")
+			if !ok {
+				continue
+			}
+			// 逐个比较 使用常量时间比较避免通过耗时猜测令牌
+			for t, identity := range a.Tokens {
+				if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+					return identity, true
+				}
+			}
+			return "", false
+		}
+	}
+	if a.MutualTLS {
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+				if cn := info.State.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+					return cn, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// 在每次rpc中携带令牌
+type tokenCredentials struct {
+	token    string
+	insecure bool // 为true时允许在没有TLS的连接上发送令牌
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// 令牌以明文传输 默认只在TLS连接上发送
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return !t.insecure
+}
+
+// TokenCredentials 返回在每次rpc中携带令牌的 credentials.PerRPCCredentials 只能在TLS连接上使用
+// 用于不是gocache节点的客户端访问启用了认证的rpc服务
+func TokenCredentials(token string) credentials.PerRPCCredentials {
+	return tokenCredentials{token: token}
+}
+
+// InsecureTokenCredentials 与 TokenCredentials 相同 但允许在没有TLS的连接上明文发送令牌 仅用于测试和可信网络
+func InsecureTokenCredentials(token string) credentials.PerRPCCredentials {
+	return tokenCredentials{token: token, insecure: true}
+}
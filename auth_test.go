@@ -0,0 +1,116 @@
+package gocache
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/neijuanxiaozi/gocache/gocachepb"
+	"github.com/neijuanxiaozi/gocache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestACL(t *testing.T) {
+	acl := NewACL().
+		Allow("reader", "scores", PermRead).
+		Allow("ops", AnyGroup, PermAll)
+	cases := []struct {
+		identity, group string
+		perm            Permission
+		want            bool
+	}{
+		{"reader", "scores", PermRead, true},
+		{"reader", "scores", PermWrite, false},
+		{"reader", "other", PermRead, false},
+		{"ops", "other", PermAdmin, true},
+		{"unknown", "scores", PermRead, false},
+	}
+	for _, c := range cases {
+		if got := acl.Allowed(c.identity, c.group, c.perm); got != c.want {
+			t.Errorf("Allowed(%s, %s, %d) = %v, want %v", c.identity, c.group, c.perm, got, c.want)
+		}
+	}
+	acl.Revoke("ops", AnyGroup, PermWrite)
+	if acl.Allowed("ops", "scores", PermWrite) || !acl.Allowed("ops", "scores", PermRead) {
+		t.Errorf("revoke write from ops failed")
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	addr := "127.0.0.1:16333"
+	auth := AuthConfig{
+		Tokens: map[string]string{"reader-token": "reader", "peer-token": "peer"},
+		ACL: NewACL().
+			Allow("reader", "auth", PermRead).
+			Allow("peer", AnyGroup, PermAll),
+		PeerToken:         "peer-token",
+		InsecurePeerToken: true,
+	}
+	// 没有TLS时 需要显式允许明文发送令牌
+	if _, err := NewServerWithRegistry(addr, registry.NewMemory(), WithAuth(AuthConfig{PeerToken: "peer-token"})); err == nil {
+		t.Fatal("peer token without tls should be rejected")
+	}
+	svr, err := NewServerWithRegistry(addr, registry.NewMemory(), WithAuth(auth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	g := NewGroup("auth", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	defer g.Close()
+
+	connect := func(opts ...grpc.DialOption) pb.GoCacheClient {
+		conn, err := grpc.NewClient(addr, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewGoCacheClient(conn)
+	}
+	ctx := context.Background()
+	code := func(err error) codes.Code { return status.Code(err) }
+
+	// 默认的令牌不在明文连接上发送
+	if _, err := grpc.NewClient(addr, grpc.WithPerRPCCredentials(TokenCredentials("reader-token")), grpc.WithTransportCredentials(insecure.NewCredentials())); err == nil {
+		t.Errorf("token credentials should require transport security")
+	}
+	anonymous := connect()
+	if _, err := anonymous.Get(ctx, &pb.GetRequest{Group: "auth", Key: "Tom"}); code(err) != codes.Unauthenticated {
+		t.Errorf("anonymous Get: %v", err)
+	}
+	forged := connect(grpc.WithPerRPCCredentials(InsecureTokenCredentials("forged")))
+	if _, err := forged.Get(ctx, &pb.GetRequest{Group: "auth", Key: "Tom"}); code(err) != codes.Unauthenticated {
+		t.Errorf("forged token Get: %v", err)
+	}
+
+	reader := connect(grpc.WithPerRPCCredentials(InsecureTokenCredentials("reader-token")))
+	if resp, err := reader.Get(ctx, &pb.GetRequest{Group: "auth", Key: "Tom"}); err != nil || string(resp.GetValue()) != "630" {
+		t.Errorf("reader Get: %v", err)
+	}
+	if _, err := reader.Set(ctx, &pb.SetRequest{Group: "auth", Key: "Tom", Value: []byte("1")}); code(err) != codes.PermissionDenied {
+		t.Errorf("reader Set: %v", err)
+	}
+	if _, err := reader.Stats(ctx, &pb.StatsRequest{Group: "auth"}); code(err) != codes.PermissionDenied {
+		t.Errorf("reader Stats: %v", err)
+	}
+	if _, err := reader.Get(ctx, &pb.GetRequest{Group: "other", Key: "Tom"}); code(err) != codes.PermissionDenied {
+		t.Errorf("reader Get on other group: %v", err)
+	}
+
+	// 节点之间使用PeerToken访问
+	c := NewClient(addr, svr.dial)
+	defer c.Close()
+	if err := c.Set(ctx, "auth", "Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FetchStats(ctx, "auth"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,325 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/singleflight"
+)
+
+// Result 是 GetMulti 中单个key的结果 Err 不为nil时 Value 无效
+type Result struct {
+	Value ByteView
+	Err   error
+}
+
+// BatchLoader 可选接口 支持一次从源获取多个key
+// 返回的map中没有的key视为不存在 返回error时所有key都视为获取失败
+type BatchLoader interface {
+	Loader
+	LoadMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// BatchTTLLoader 可选接口 批量获取源数据的同时返回每个key的过期时长
+// ttls中没有的key或过期时长<=0时使用 Group 的默认过期时长
+type BatchTTLLoader interface {
+	BatchLoader
+	LoadMultiTTL(ctx context.Context, keys []string) (values map[string][]byte, ttls map[string]time.Duration, err error)
+}
+
+// GetMulti 批量获取多个key 返回每个key的结果
+// 先查本地缓存 未命中的key按所属节点分组 每个远程节点只发起一次 BatchGet rpc 各节点之间并行
+// 节点失败时与 Get 一样依次尝试key的其他副本
+// 属于本节点的key 若回调函数实现了 BatchLoader 则一次性从源获取 否则逐个获取
+func (g *Group) GetMulti(ctx context.Context, keys []string) map[string]Result {
+	return g.getMulti(ctx, keys, true)
+}
+
+// 处理其他节点发来的 BatchGet 请求 请求方已经选定本节点 未命中的key全部从本地获取 不再转发
+func (g *Group) getMultiForPeer(ctx context.Context, keys []string) map[string]Result {
+	return g.getMulti(ctx, keys, false)
+}
+
+// GetMulti 的实现 pick为false时不选择远程节点
+func (g *Group) getMulti(ctx context.Context, keys []string, pick bool) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	var mu sync.Mutex // 保护 results 的并发写入
+	// 本地缓存查找 并记录未命中的key按优先级可以尝试的节点
+	var local, spilled []string
+	owners := make(map[string][]Fetcher)
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue
+		}
+		if key == "" {
+			results[key] = Result{Err: ErrEmptyKey}
+			continue
+		}
+		g.stats.gets.Add(1)
+		if v, ok := g.cache.get(key); ok {
+			g.stats.localHits.Add(1)
+			g.maybeRefresh(key, v)
+			results[key] = Result{Value: v}
+			continue
+		}
+		// 有界负载时其他节点的请求可能溢出到本节点 本节点不是副本时不放入主缓存 与 getForPeer 一致
+		spill := !pick && !g.isReplica(key)
+		// 处理其他节点的请求时 只有溢出的key查找热点缓存 与 getForPeer 一致
+		if pick || spill {
+			if v, ok := g.hotCache.get(key); ok {
+				g.stats.hotHits.Add(1)
+				results[key] = Result{Value: v}
+				continue
+			}
+		}
+		if g.tombstoned(key) {
+			results[key] = Result{Err: notFound(key)}
+			continue
+		}
+		g.stats.misses.Add(1)
+		// 先占位 避免重复的key被多次获取
+		results[key] = Result{}
+		if pick {
+			owners[key] = g.owners(key)
+			continue
+		}
+		if spill {
+			spilled = append(spilled, key)
+			continue
+		}
+		local = append(local, key)
+	}
+
+	var wg sync.WaitGroup
+	if len(owners) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ownerResults := g.getMultiFromOwners(ctx, owners)
+			mu.Lock()
+			for key, result := range ownerResults {
+				results[key] = result
+			}
+			mu.Unlock()
+		}()
+	}
+	for _, key := range spilled {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			view, err := g.getSpilledOnce(ctx, key)
+			mu.Lock()
+			results[key] = Result{Value: view, Err: err}
+			mu.Unlock()
+		}(key)
+	}
+	if len(local) > 0 {
+		localResults := g.getMultiLocally(ctx, local)
+		mu.Lock()
+		for key, result := range localResults {
+			results[key] = result
+		}
+		mu.Unlock()
+	}
+	wg.Wait()
+	return results
+}
+
+// 按副本的优先级批量获取 owners为每个key剩余可以尝试的节点 nil表示本节点
+// 与 load 一致 key按第一个节点分组 每个远程节点只发起一次 BatchGet rpc 各节点之间并行
+// 节点失败的key尝试各自的下一个副本 所有副本都失败时从本地源获取
+func (g *Group) getMultiFromOwners(ctx context.Context, owners map[string][]Fetcher) map[string]Result {
+	results := make(map[string]Result, len(owners))
+	var mu sync.Mutex
+	var local []string
+	remote := make(map[Fetcher][]string)
+	for key, fetchers := range owners {
+		if len(fetchers) == 0 || fetchers[0] == nil {
+			local = append(local, key)
+			continue
+		}
+		remote[fetchers[0]] = append(remote[fetchers[0]], key)
+	}
+
+	var wg sync.WaitGroup
+	for fetcher, peerKeys := range remote {
+		wg.Add(1)
+		go func(fetcher Fetcher, peerKeys []string) {
+			defer wg.Done()
+			peerResults, err := fetcher.BatchFetch(ctx, g.name, peerKeys)
+			if err != nil {
+				g.stats.peerErrors.Add(1)
+				if ctx.Err() == nil {
+					g.logger.Warn("failed to batch get from peer", "group", g.name, "keys", len(peerKeys), "error", err)
+				}
+			}
+			next := make(map[string][]Fetcher)
+			mu.Lock()
+			for _, key := range peerKeys {
+				result, ok := peerResults[key]
+				switch {
+				case err != nil:
+					result = Result{Err: err}
+				case !ok:
+					result = Result{Err: fmt.Errorf("peer returned no result for key %s", key)}
+				}
+				if result.Err == nil {
+					g.stats.peerLoads.Add(1)
+					g.mirror(key, result.Value)
+					results[key] = result
+					continue
+				}
+				// 所属节点确认key不存在 不再尝试其他副本 在本地也记录墓碑
+				if errors.Is(result.Err, ErrNotFound) {
+					g.addTombstone(key)
+					results[key] = result
+					continue
+				}
+				// 调用者已经超时或取消 不再尝试其他副本和本地获取
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					results[key] = Result{Err: ctxErr}
+					continue
+				}
+				next[key] = owners[key][1:]
+			}
+			mu.Unlock()
+			if len(next) == 0 {
+				return
+			}
+			nextResults := g.getMultiFromOwners(ctx, next)
+			mu.Lock()
+			for key, result := range nextResults {
+				results[key] = result
+			}
+			mu.Unlock()
+		}(fetcher, peerKeys)
+	}
+	// 本节点是副本之一 或所有副本都失败 从本地源获取 计入本节点的负载
+	if len(local) > 0 {
+		end := func() {}
+		if r, ok := g.server.(localLoadReporter); ok {
+			end = r.beginLocalLoad()
+		}
+		localResults := g.getMultiLocally(ctx, local)
+		end()
+		mu.Lock()
+		for key, result := range localResults {
+			results[key] = result
+		}
+		mu.Unlock()
+	}
+	wg.Wait()
+	return results
+}
+
+// 从本地源批量获取数据并放入缓存
+func (g *Group) getMultiLocally(ctx context.Context, keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	bl, ok := g.retriever.(BatchLoader)
+	if !ok {
+		// 不支持批量获取 逐个并行获取 仍然经过 singleflight 去重
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				view, err := g.getLocallyOnce(ctx, key)
+				mu.Lock()
+				results[key] = Result{Value: view, Err: err}
+				mu.Unlock()
+			}(key)
+		}
+		wg.Wait()
+		return results
+	}
+	// 每个key经过 singleflight 去重 正在被其他调用获取的key等待其结果 其余key合并为一次批量获取
+	flown := g.flight.FlyMulti(ctx, keys, func(ctx context.Context, keys []string) map[string]singleflight.Result {
+		return g.loadMulti(ctx, bl, keys)
+	})
+	for key, r := range flown {
+		if r.Err != nil {
+			results[key] = Result{Err: r.Err}
+			continue
+		}
+		results[key] = Result{Value: r.Val.(ByteView)}
+	}
+	return results
+}
+
+// 调用 BatchLoader 批量获取源数据并放入缓存 返回每个key的结果
+func (g *Group) loadMulti(ctx context.Context, bl BatchLoader, keys []string) map[string]singleflight.Result {
+	defer g.observeLoad(time.Now())
+	results := make(map[string]singleflight.Result, len(keys))
+	g.stats.retrieverLoads.Add(1)
+	values, ttls, err := loadMultiTTL(ctx, bl, keys)
+	if err != nil {
+		g.stats.retrieverErrors.Add(1)
+		err = retrieverError(err)
+	}
+	for _, key := range keys {
+		// 整个批量获取失败时无法判断哪些key不存在 所有key都视为获取失败 不写入墓碑
+		if err != nil {
+			results[key] = singleflight.Result{Err: err}
+			continue
+		}
+		// 批量获取成功时 返回的map中没有的key才是不存在的key
+		bytes, ok := values[key]
+		if !ok {
+			g.addTombstone(key)
+			results[key] = singleflight.Result{Err: notFound(key)}
+			continue
+		}
+		value := g.newView(bytes, ttls[key])
+		g.populateCache(key, value)
+		g.replicate(key, value)
+		results[key] = singleflight.Result{Val: value}
+	}
+	return results
+}
+
+// 经过 singleflight 从本地源获取单个key 用于本节点不是副本时溢出到本节点的请求
+// 副本上的写入到达不了本节点 值不放入主缓存 只以 defaultSpillTTL 的过期时长放入热点缓存
+// 热点key持续溢出时 每个 defaultSpillTTL 最多访问一次源数据 写入最多在 defaultSpillTTL 后可见
+func (g *Group) getSpilledOnce(ctx context.Context, key string) (ByteView, error) {
+	view, err := g.flight.Fly(ctx, key, func(ctx context.Context) (interface{}, error) {
+		defer g.observeLoad(time.Now())
+		value, err := g.retrieveView(ctx, key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				g.addTombstone(key)
+			}
+			return ByteView{}, err
+		}
+		g.hotCache.add(key, spillView(value))
+		return value, nil
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+// 返回溢出的值放入热点缓存时使用的副本 过期时间不晚于 defaultSpillTTL 之后 不在后台刷新
+func spillView(v ByteView) ByteView {
+	expire := time.Now().Add(defaultSpillTTL)
+	if !v.e.IsZero() && v.e.Before(expire) {
+		expire = v.e
+	}
+	return ByteView{b: v.b, e: expire}
+}
+
+// 经过 singleflight 从本地源获取单个key
+func (g *Group) getLocallyOnce(ctx context.Context, key string) (ByteView, error) {
+	view, err := g.flight.Fly(ctx, key, func(ctx context.Context) (interface{}, error) {
+		defer g.observeLoad(time.Now())
+		return g.getLocally(ctx, key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
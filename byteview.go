@@ -1,7 +1,11 @@
 package gocache
 
+import "time"
+
 type ByteView struct {
-	b []byte //存储缓存真实值
+	b []byte    //存储缓存真实值
+	e time.Time // 过期时间 零值表示永不过期
+	s time.Time // 软过期时间 之后命中时返回旧值并在后台刷新 零值表示不使用
 }
 
 // 在 lru.Cache 的实现中，要求被缓存对象必须实现 Value 接口，即 Len() int 方法，返回其所占的内存大小
@@ -14,6 +18,16 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// 返回缓存值的过期时间 零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// 返回值是否已经超过软过期时间 变旧的值仍然可以使用 后台正在或即将刷新
+func (v ByteView) Stale() bool {
+	return !v.s.IsZero() && time.Now().After(v.s)
+}
+
 // 输出缓存的字符串表示
 func (v ByteView) String() string {
 	return string(v.b)
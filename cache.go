@@ -2,19 +2,58 @@ package gocache
 
 import (
 	"sync"
+	"time"
 
 	"github.com/neijuanxiaozi/gocache/lru"
 )
 
+// 后台清理过期缓存的时间间隔
+const defaultCleanupInterval = time.Minute
+
 // cache.go 的实现非常简单，实例化 lru，封装 get 和 add 方法，并添加互斥锁 mu。
 type cache struct {
-	mu       sync.Mutex // 互斥锁
-	lru      *lru.Cache // lru
-	capacity int64      // 缓存大小
+	mu       sync.Mutex    // 互斥锁
+	lru      *lru.Cache    // lru
+	capacity int64         // 缓存大小
+	stop     chan struct{} // 通知后台清理协程退出 为nil表示清理协程未启动
+	nget     int64         // 查询次数
+	nhit     int64         // 命中次数
+	policy   lru.Policy    // 淘汰策略
+	cleanup  time.Duration // 后台清理过期缓存的时间间隔 <=0时使用默认间隔
 }
 
-func newCache(capacity int64) *cache {
-	return &cache{capacity: capacity}
+// EvictionPolicy 是缓存容量不足时选择被淘汰key的策略
+type EvictionPolicy = lru.Policy
+
+const (
+	EvictLRU  = lru.LRU  // 淘汰最久未被访问的key 默认策略
+	EvictFIFO = lru.FIFO // 淘汰最早写入的key
+)
+
+// CacheStats 是某个缓存的统计信息快照
+type CacheStats struct {
+	Bytes     int64 // 当前使用的内存
+	Items     int64 // 当前缓存的key个数
+	Gets      int64 // 查询次数
+	Hits      int64 // 命中次数
+	Evictions int64 // 因容量不足被淘汰的key个数
+}
+
+// CacheType 表示 Group 中的哪一个缓存
+type CacheType int
+
+const (
+	// MainCache 保存本节点负责的key
+	MainCache CacheType = iota + 1
+	// HotCache 保存从远程节点获取的热点key的镜像
+	HotCache
+	// NegativeCache 保存不存在的key的墓碑
+	NegativeCache
+)
+
+// 按 Group 的配置创建cache
+func newCache(capacity int64, o groupOptions) *cache {
+	return &cache{capacity: capacity, policy: o.policy, cleanup: o.cleanupInterval}
 }
 
 // 在 add 方法中，判断了 c.lru 是否为 nil，如果等于 nil 再创建实例。
@@ -25,19 +64,79 @@ func (c *cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
-		c.lru = lru.New(c.capacity, nil)
+		c.lru = lru.NewWithPolicy(c.capacity, c.policy, nil)
 	}
-	c.lru.Add(key, value)
+	// 第一次添加会过期的值时 启动后台清理协程
+	if !value.Expire().IsZero() && c.stop == nil {
+		c.stop = make(chan struct{})
+		interval := c.cleanup
+		if interval <= 0 {
+			interval = defaultCleanupInterval
+		}
+		go c.janitor(interval, c.stop)
+	}
+	c.lru.AddWithExpire(key, value, value.Expire())
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nget++
 	if c.lru == nil {
 		return
 	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
 	if v, ok := c.lru.Get(key); ok {
+		c.nhit++
 		return v.(ByteView), ok
 	}
 	return
 }
+
+// 删除缓存中的key
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	c.lru.Delete(key)
+}
+
+// 返回缓存的统计信息
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheStats{Gets: c.nget, Hits: c.nhit}
+	if c.lru != nil {
+		stats.Bytes = c.lru.Bytes()
+		stats.Items = int64(c.lru.Len())
+		stats.Evictions = c.lru.Evictions()
+	}
+	return stats
+}
+
+// janitor 定期清理已过期但一直未被访问的缓存 回收内存
+func (c *cache) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			c.lru.RemoveExpired()
+			c.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 停止后台清理协程
+func (c *cache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
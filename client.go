@@ -2,49 +2,244 @@ package gocache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/neijuanxiaozi/gocache/consistenthash"
 	pb "github.com/neijuanxiaozi/gocache/gocachepb"
-	"github.com/neijuanxiaozi/gocache/registry"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
+// 调用者的ctx没有设置超时时间时 rpc调用的默认超时时间
+const defaultRPCTimeout = 10 * time.Second
+
+// 建立与远端节点的grpc连接 由 server 提供
+type dialFunc func(peerAddr string) (*grpc.ClientConn, error)
+
 type client struct {
-	name string // 要访问远端节点的路径   gocache/ip:port
+	name string           // 要访问远端节点的地址   ip:port
+	dial dialFunc         // 建立连接的函数
+	mu   sync.Mutex       // 保护conn
+	conn *grpc.ClientConn // 与远端节点的长连接 第一次使用时建立 失败后重建
+	// 有界负载一致性哈希 不为nil时在每次rpc前后报告该节点的负载
+	loads *consistenthash.Bounded
+	// 每种rpc的统计信息 创建后不再修改 可以并发读取
+	stats map[string]*rpcStats
+	// 调用者的ctx没有设置超时时间时 rpc的超时时间
+	timeout time.Duration
 }
 
-func NewClient(peerAddr string) *client {
-	return &client{name: peerAddr}
+// 客户端会调用的rpc方法名 用于统计
+var rpcMethods = []string{"Get", "BatchGet", "Set", "Delete", "Stats"}
+
+func NewClient(peerAddr string, dial dialFunc) *client {
+	stats := make(map[string]*rpcStats, len(rpcMethods))
+	for _, method := range rpcMethods {
+		stats[method] = &rpcStats{}
+	}
+	return &client{name: peerAddr, dial: dial, stats: stats, timeout: defaultRPCTimeout}
 }
 
-func (c *client) Fetch(group string, key string) ([]byte, error) {
-	// 用etcd配置对象 创建一个etcd client
-	cli, err := clientv3.New(defaultEtcdConfig)
+// 获取与远端节点的连接 连接不存在或已关闭时重新建立
+func (c *client) getConn() (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && c.conn.GetState() != connectivity.Shutdown {
+		return c.conn, nil
+	}
+	conn, err := c.dial(c.name)
 	if err != nil {
 		return nil, err
 	}
-	defer cli.Close()
-	// 发现服务 获得与服务的连接
-	conn, err := registry.EtcdDial(cli, c.name)
+	c.conn = conn
+	return conn, nil
+}
+
+// 连接不可用时关闭并丢弃该连接 下一次调用时重新建立
+func (c *client) resetConn(conn *grpc.ClientConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != conn {
+		return
+	}
+	c.conn.Close()
+	c.conn = nil
+}
+
+// Close 关闭与远端节点的连接 节点被移除或server停止时调用
+func (c *client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// 在与远端节点的长连接上执行一次rpc调用 method是rpc方法名 用于统计
+func (c *client) call(ctx context.Context, method string, fn func(ctx context.Context, grpcClient pb.GoCacheClient) error) (err error) {
+	if c.loads != nil {
+		c.loads.Begin(c.name)
+		defer c.loads.End(c.name)
+	}
+	start := time.Now()
+	defer func() {
+		c.stats[method].observe(time.Since(start), err)
+	}()
+	// 获得与服务的连接
+	conn, err := c.getConn()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%w: %v", ErrPeerUnavailable, err)
 	}
-	defer conn.Close()
 	// 创建grpc客户端对象
 	grpcClient := pb.NewGoCacheClient(conn)
-	// 创建一个带有超时时间的上下文 cancel是一个函数，调用它将会取消与该上下文关联的所有操作
+	// 调用者没有设置超时时间时 创建一个带有默认超时时间的上下文 cancel是一个函数，调用它将会取消与该上下文关联的所有操作
 	// 在实际应用中，通常会将 ctx 传递给需要执行的操作或函数，以便它们能够感知到超时信号，并在必要时停止执行。
 	// 如果超时发生或者调用了 cancel 函数，
 	// 任何接收了 ctx 的函数都应该能够检测到这个信号，并据此作出响应，比如停止阻塞操作、返回错误等。
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	// rpc调用
-	resp, err := grpcClient.Get(ctx, &pb.GetRequest{Group: group, Key: key})
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err = fn(ctx, grpcClient)
+	// 远端节点不可达 丢弃连接 下次调用时重新建立
+	if status.Code(err) == codes.Unavailable {
+		c.resetConn(conn)
+	}
+	// 还原为gocache的错误 调用者可以用 errors.Is 判断
+	return fromStatus(err)
+}
+
+func (c *client) Fetch(ctx context.Context, group string, key string) (ByteView, error) {
+	var resp *pb.GetResponse
+	err := c.call(ctx, "Get", func(ctx context.Context, grpcClient pb.GoCacheClient) error {
+		var err error
+		// rpc调用
+		resp, err = grpcClient.Get(ctx, &pb.GetRequest{Group: group, Key: key})
+		return err
+	})
+	if err != nil {
+		return ByteView{}, fmt.Errorf("get %s/%s from peer %s: %w", group, key, c.name, err)
+	}
+	view := ByteView{b: resp.GetValue()}
+	// 保留远程节点上的过期时间 使取回的值不会比源节点上的值存活更久
+	if expireAt := resp.GetExpireAt(); expireAt > 0 {
+		view.e = time.Unix(0, expireAt)
+	}
+	return view, nil
+}
+
+// BatchFetch 在一次rpc中从远端节点获取多个key
+func (c *client) BatchFetch(ctx context.Context, group string, keys []string) (map[string]Result, error) {
+	var resp *pb.BatchGetResponse
+	err := c.call(ctx, "BatchGet", func(ctx context.Context, grpcClient pb.GoCacheClient) error {
+		var err error
+		resp, err = grpcClient.BatchGet(ctx, &pb.BatchGetRequest{Group: group, Keys: keys})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch get %d keys of %s from peer %s: %w", len(keys), group, c.name, err)
+	}
+	results := make(map[string]Result, len(resp.GetItems()))
+	for _, item := range resp.GetItems() {
+		if item.GetError() != "" {
+			results[item.GetKey()] = Result{Err: itemError(item)}
+			continue
+		}
+		view := ByteView{b: item.GetValue()}
+		if expireAt := item.GetExpireAt(); expireAt > 0 {
+			view.e = time.Unix(0, expireAt)
+		}
+		results[item.GetKey()] = Result{Value: view}
+	}
+	return results, nil
+}
+
+// 还原批量获取中单个key的错误
+func itemError(item *pb.BatchGetItem) error {
+	if err := reasonError(item.GetReason()); err != nil {
+		return &remoteError{msg: item.GetError(), err: err}
+	}
+	return errors.New(item.GetError())
+}
+
+// Set 将kv写入远端节点
+func (c *client) Set(ctx context.Context, group string, key string, value []byte) error {
+	return c.setWithExpire(ctx, group, key, value, time.Time{})
+}
+
+// 将kv写入远端节点 expire为零值时使用远端节点的默认过期时长
+func (c *client) setWithExpire(ctx context.Context, group string, key string, value []byte, expire time.Time) error {
+	req := &pb.SetRequest{Group: group, Key: key, Value: value}
+	if !expire.IsZero() {
+		req.ExpireAt = expire.UnixNano()
+	}
+	err := c.call(ctx, "Set", func(ctx context.Context, grpcClient pb.GoCacheClient) error {
+		_, err := grpcClient.Set(ctx, req)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.name)
+		return fmt.Errorf("set %s/%s to peer %s: %w", group, key, c.name, err)
+	}
+	return nil
+}
+
+// Delete 删除远端节点上的key
+func (c *client) Delete(ctx context.Context, group string, key string) error {
+	err := c.call(ctx, "Delete", func(ctx context.Context, grpcClient pb.GoCacheClient) error {
+		_, err := grpcClient.Delete(ctx, &pb.DeleteRequest{Group: group, Key: key})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete %s/%s from peer %s: %w", group, key, c.name, err)
+	}
+	return nil
+}
+
+// FetchStats 获取远端节点上某个 Group 的统计信息
+func (c *client) FetchStats(ctx context.Context, group string) (Stats, error) {
+	var resp *pb.StatsResponse
+	err := c.call(ctx, "Stats", func(ctx context.Context, grpcClient pb.GoCacheClient) error {
+		var err error
+		resp, err = grpcClient.Stats(ctx, &pb.StatsRequest{Group: group})
+		return err
+	})
+	if err != nil {
+		return Stats{}, fmt.Errorf("get stats of %s from peer %s: %w", group, c.name, err)
+	}
+	return Stats{
+		Gets:            resp.GetGets(),
+		LocalHits:       resp.GetLocalHits(),
+		HotHits:         resp.GetHotHits(),
+		NegativeHits:    resp.GetNegativeHits(),
+		PeerLoads:       resp.GetPeerLoads(),
+		PeerErrors:      resp.GetPeerErrors(),
+		RetrieverLoads:  resp.GetRetrieverLoads(),
+		RetrieverErrors: resp.GetRetrieverErrors(),
+		Dedups:          resp.GetDedups(),
+		Evictions:       resp.GetEvictions(),
+		Bytes:           resp.GetBytes(),
+		Items:           resp.GetItems(),
+		InFlight:        resp.GetInFlight(),
+		Refreshes:       resp.GetRefreshes(),
+	}, nil
+}
+
+// 返回访问该远端节点的统计信息
+func (c *client) peerStats() PeerStats {
+	methods := make(map[string]RPCStats, len(c.stats))
+	for method, stats := range c.stats {
+		methods[method] = stats.snapshot()
 	}
-	return resp.Value, nil
+	return PeerStats{Addr: c.name, Methods: methods}
 }
 
 var _ Fetcher = (*client)(nil)
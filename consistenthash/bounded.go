@@ -0,0 +1,90 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Bounded 是有界负载的一致性哈希(consistent hashing with bounded loads)
+// 每个节点的负载上限为 (1+epsilon)*平均负载(按权重折算) 当key在环上对应的节点已达上限时
+// 沿环顺时针找到第一个未达上限的节点 热点区间的请求因此确定地溢出到环上的下一个节点
+// 负载由调用者通过 Begin/End 报告 一般为发往该节点的进行中请求数 本节点为自己处理的请求也应计入
+// 溢出只适用于读请求 写入和删除应发往 Consistentency.GetPeer 返回的固定节点
+type Bounded struct {
+	*Consistentency
+	epsilon float64
+	mu      sync.Mutex       // 保护loads和total 与环本身的并发控制无关
+	loads   map[string]int64 // 每个节点的当前负载
+	total   int64            // 所有节点的负载之和
+}
+
+// NewBounded 创建有界负载一致性哈希 epsilon为允许超出平均负载的比例 如0.25表示上限为平均负载的1.25倍
+func NewBounded(replicas int, epsilon float64, fn HashFunc) *Bounded {
+	return &Bounded{
+		Consistentency: New(replicas, fn),
+		epsilon:        epsilon,
+		loads:          make(map[string]int64),
+	}
+}
+
+// GetPeer 返回key在环上顺时针方向第一个未达负载上限的节点
+func (b *Bounded) GetPeer(key string) string {
+	c := b.Consistentency
+	if len(c.ring) == 0 {
+		return ""
+	}
+	hashValue := int(c.hash([]byte(key)))
+	idx := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i] >= hashValue
+	})
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	totalWeight := 0
+	for _, weight := range c.weights {
+		totalWeight += weight
+	}
+	// 所有节点的上限之和大于total 所以一定能找到未达上限的节点
+	for i := 0; i < len(c.ring); i++ {
+		peer := c.hashmap[c.ring[(idx+i)%len(c.ring)]][0]
+		if b.loads[peer] < b.capacity(peer, totalWeight) {
+			return peer
+		}
+	}
+	return c.hashmap[c.ring[idx%len(c.ring)]][0]
+}
+
+// 节点的负载上限 按权重分摊加上这次请求后的总负载 再乘以(1+epsilon) 向上取整
+func (b *Bounded) capacity(peer string, totalWeight int) int64 {
+	avg := float64(b.total+1) * float64(b.weights[peer]) / float64(totalWeight)
+	return int64(math.Ceil(avg * (1 + b.epsilon)))
+}
+
+// Begin 节点的负载加一 在向节点发出请求前调用
+func (b *Bounded) Begin(peer string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loads[peer]++
+	b.total++
+}
+
+// End 节点的负载减一 在请求结束后调用
+func (b *Bounded) End(peer string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loads[peer] <= 0 {
+		return
+	}
+	b.loads[peer]--
+	b.total--
+	if b.loads[peer] == 0 {
+		delete(b.loads, peer)
+	}
+}
+
+// Load 返回节点的当前负载
+func (b *Bounded) Load(peer string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[peer]
+}
@@ -11,17 +11,21 @@ type HashFunc func(data []byte) uint32
 
 // Map 是一致性哈希算法的主数据结构
 type Consistentency struct {
-	hash     HashFunc       // Hash函数
-	replicas int            // 虚拟节点个数
-	ring     []int          // 哈希环
-	hashmap  map[int]string // 虚拟节点与真实节点的映射表 键是虚拟节点的哈希值 值是真实节点的名称
+	hash     HashFunc         // Hash函数
+	replicas int              // 虚拟节点个数
+	ring     []int            // 哈希环 有序且不重复
+	hashmap  map[int][]string // 虚拟节点与真实节点的映射表 键是虚拟节点的哈希值 值是占用该哈希值的真实节点 按名称排序 第一个为实际归属
+	peers    map[string][]int // 真实节点与其虚拟节点哈希值的映射表 用于删除节点
+	weights  map[string]int   // 真实节点的权重 虚拟节点个数为 replicas*权重
 }
 
 func New(replicas int, fn HashFunc) *Consistentency {
 	c := &Consistentency{
 		hash:     fn,
 		replicas: replicas,
-		hashmap:  make(map[int]string),
+		hashmap:  make(map[int][]string),
+		peers:    make(map[string][]int),
+		weights:  make(map[string]int),
 	}
 	if c.hash == nil {
 		c.hash = crc32.ChecksumIEEE //  ChecksumIEEE需要更详细的资料
@@ -30,22 +34,144 @@ func New(replicas int, fn HashFunc) *Consistentency {
 }
 
 // 添加节点方法Add()
-// Add 函数允许传入 0 或 多个真实节点的名称
+// Add 函数允许传入 0 或 多个真实节点的名称 节点权重为1 已存在的节点会被忽略
+// 只把新节点的虚拟节点合并到环上 不重建整个环 但每次调用都会复制一次环
+// 添加多个节点时应一次传入所有节点 或使用 RegisterAll 逐个添加N个节点需要O(N²·replicas)的时间
 func (c *Consistentency) Register(peersName ...string) {
-	// 对每一个真实节点 key，对应创建 m.replicas 个虚拟节点，
+	var added []int
+	for _, peerName := range peersName {
+		if c.Has(peerName) {
+			continue
+		}
+		added = append(added, c.register(peerName, 1)...)
+	}
+	c.merge(added)
+}
+
+// RegisterWeighted 添加一个带权重的节点 虚拟节点个数为 replicas*weight 使节点拥有的key与权重成正比
+// weight<=0 时按1处理 节点已存在且权重不同时 按新权重重新添加
+func (c *Consistentency) RegisterWeighted(peerName string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	if c.Has(peerName) {
+		if c.weights[peerName] == weight {
+			return
+		}
+		c.Remove(peerName)
+	}
+	c.merge(c.register(peerName, weight))
+}
+
+// RegisterAll 一次添加多个带权重的节点 结果与逐个调用 RegisterWeighted 相同
+// 所有新的虚拟节点只与环归并一次
+func (c *Consistentency) RegisterAll(weights map[string]int) {
+	var added []int
+	for peerName, weight := range weights {
+		if weight <= 0 {
+			weight = 1
+		}
+		if c.Has(peerName) {
+			if c.weights[peerName] == weight {
+				continue
+			}
+			c.Remove(peerName)
+		}
+		added = append(added, c.register(peerName, weight)...)
+	}
+	c.merge(added)
+}
+
+// Weight 返回节点的权重 节点不存在时返回0
+func (c *Consistentency) Weight(peerName string) int {
+	return c.weights[peerName]
+}
+
+// 为节点创建虚拟节点 返回需要新添加到环上的哈希值
+func (c *Consistentency) register(peerName string, weight int) []int {
+	var added []int
+	// 对每一个真实节点 key，对应创建 m.replicas*weight 个虚拟节点，
 	// 虚拟节点的名称是：strconv.Itoa(i) + key，即通过添加编号的方式区分不同虚拟节点.
+	replicas := c.replicas * weight
+	hashValues := make([]int, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		// 使用 m.hash() 计算虚拟节点的哈希值，
+		hashValue := int(c.hash([]byte(strconv.Itoa(i) + peerName)))
+		owners := c.hashmap[hashValue]
+		// 同一节点的两个虚拟节点哈希冲突 只保留一个
+		if containsPeer(owners, peerName) {
+			continue
+		}
+		// 新的哈希值 需要添加到环上
+		if len(owners) == 0 {
+			added = append(added, hashValue)
+		}
+		// 不同节点的虚拟节点哈希冲突时不覆盖 按名称排序 由名称最小的节点拥有该位置
+		// 这样无论节点注册顺序如何 结果都相同 且删除节点后其他节点可以接管该位置
+		c.hashmap[hashValue] = insertPeer(owners, peerName)
+		hashValues = append(hashValues, hashValue)
+	}
+	c.peers[peerName] = hashValues
+	c.weights[peerName] = weight
+	return added
+}
+
+// 新的哈希值排序后与环归并
+func (c *Consistentency) merge(added []int) {
+	if len(added) == 0 {
+		return
+	}
+	sort.Ints(added)
+	c.ring = mergeSorted(c.ring, added)
+}
+
+// Remove 从环上删除节点 只删除这些节点的虚拟节点 不重建整个环
+func (c *Consistentency) Remove(peersName ...string) {
+	removed := make(map[int]bool)
 	for _, peerName := range peersName {
-		for i := 0; i < c.replicas; i++ {
-			// 使用 m.hash() 计算虚拟节点的哈希值，
-			hashValue := int(c.hash([]byte(strconv.Itoa(i) + peerName)))
-			// 使用 append(m.keys, hash) 添加到环上
-			c.ring = append(c.ring, hashValue)
-			// 在 hashMap 中增加虚拟节点和真实节点的映射关系
-			c.hashmap[hashValue] = peerName
+		hashValues, ok := c.peers[peerName]
+		if !ok {
+			continue
+		}
+		for _, hashValue := range hashValues {
+			owners := removePeer(c.hashmap[hashValue], peerName)
+			if len(owners) == 0 {
+				delete(c.hashmap, hashValue)
+				removed[hashValue] = true
+				continue
+			}
+			c.hashmap[hashValue] = owners
+		}
+		delete(c.peers, peerName)
+		delete(c.weights, peerName)
+	}
+	if len(removed) == 0 {
+		return
+	}
+	// 原地过滤掉被删除的哈希值 环仍然有序
+	ring := c.ring[:0]
+	for _, hashValue := range c.ring {
+		if !removed[hashValue] {
+			ring = append(ring, hashValue)
 		}
 	}
-	// 环上的哈希值排序
-	sort.Ints(c.ring)
+	c.ring = ring
+}
+
+// Has 判断节点是否在环上
+func (c *Consistentency) Has(peerName string) bool {
+	_, ok := c.peers[peerName]
+	return ok
+}
+
+// Peers 返回环上的所有真实节点 按名称排序
+func (c *Consistentency) Peers() []string {
+	peers := make([]string, 0, len(c.peers))
+	for peerName := range c.peers {
+		peers = append(peers, peerName)
+	}
+	sort.Strings(peers)
+	return peers
 }
 
 func (c *Consistentency) GetPeer(key string) string {
@@ -60,5 +186,87 @@ func (c *Consistentency) GetPeer(key string) string {
 		return c.ring[i] >= hashValue
 	})
 	// 返回虚拟节点对应的真实节点 如果idx==len(m.keys) 说明应该选择m.keys[0] 因为keys是个环状结构
-	return c.hashmap[c.ring[idx%len(c.ring)]]
+	return c.hashmap[c.ring[idx%len(c.ring)]][0]
+}
+
+// GetPeers 从key的位置沿环顺时针找到n个不同的真实节点 用于副本放置
+func (c *Consistentency) GetPeers(key string, n int) []string {
+	if len(c.ring) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(c.peers) {
+		n = len(c.peers)
+	}
+	hashValue := int(c.hash([]byte(key)))
+	idx := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i] >= hashValue
+	})
+	peers := make([]string, 0, n)
+	for i := 0; i < len(c.ring) && len(peers) < n; i++ {
+		peer := c.hashmap[c.ring[(idx+i)%len(c.ring)]][0]
+		if !containsPeer(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// Distribution 返回每个节点拥有的哈希空间比例 用于检查节点间的负载是否与权重相符
+// 环上每个位置拥有从上一个位置(不含)到该位置(含)的一段哈希空间
+func (c *Consistentency) Distribution() map[string]float64 {
+	dist := make(map[string]float64, len(c.peers))
+	if len(c.ring) == 0 {
+		return dist
+	}
+	const space = float64(1 << 32)
+	prev := c.ring[len(c.ring)-1] - (1 << 32) // 第一个位置的区间从最后一个位置绕环开始
+	for _, hashValue := range c.ring {
+		dist[c.hashmap[hashValue][0]] += float64(hashValue-prev) / space
+		prev = hashValue
+	}
+	return dist
+}
+
+func containsPeer(peers []string, peerName string) bool {
+	for _, p := range peers {
+		if p == peerName {
+			return true
+		}
+	}
+	return false
+}
+
+// 将节点按名称顺序插入
+func insertPeer(peers []string, peerName string) []string {
+	idx := sort.SearchStrings(peers, peerName)
+	peers = append(peers, "")
+	copy(peers[idx+1:], peers[idx:])
+	peers[idx] = peerName
+	return peers
+}
+
+func removePeer(peers []string, peerName string) []string {
+	for i, p := range peers {
+		if p == peerName {
+			return append(peers[:i], peers[i+1:]...)
+		}
+	}
+	return peers
+}
+
+// 归并两个有序切片
+func mergeSorted(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
 }
@@ -4,6 +4,7 @@ import (
 	"hash/crc32"
 	"log"
 	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -35,3 +36,101 @@ func TestConsistency_GetPeer(t *testing.T) {
 	peer := c.GetPeer(key)
 	log.Printf("Go to search -> %s\n", peer)
 }
+
+func TestConsistency_Remove(t *testing.T) {
+	c := New(50, nil)
+	c.Register("peer1", "peer2", "peer3")
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = c.GetPeer(key)
+	}
+	c.Remove("peer2")
+	if c.Has("peer2") || len(c.Peers()) != 2 || len(c.ring) != 100 {
+		t.Fatalf("remove peer2 failed: %v %d", c.Peers(), len(c.ring))
+	}
+	// 只有原来属于peer2的key需要迁移
+	for key, owner := range owners {
+		peer := c.GetPeer(key)
+		if peer == "peer2" || (owner != "peer2" && peer != owner) {
+			t.Fatalf("key %s moved from %s to %s", key, owner, peer)
+		}
+	}
+	// 重新加入后 归属与之前完全一致
+	c.Register("peer2")
+	for key, owner := range owners {
+		if peer := c.GetPeer(key); peer != owner {
+			t.Fatalf("key %s moved from %s to %s", key, owner, peer)
+		}
+	}
+}
+
+func TestConsistency_Collision(t *testing.T) {
+	// 所有虚拟节点哈希值相同 模拟哈希冲突
+	c := New(2, func(data []byte) uint32 { return 1 })
+	c.Register("peer2", "peer1")
+	if len(c.ring) != 1 || c.GetPeer("Tom") != "peer1" {
+		t.Fatalf("Actual: %d %s\tExpect: 1 peer1", len(c.ring), c.GetPeer("Tom"))
+	}
+	// 冲突位置的拥有者被删除后 由另一个节点接管
+	c.Remove("peer1")
+	if c.GetPeer("Tom") != "peer2" {
+		t.Fatalf("Actual: %s\tExpect: peer2", c.GetPeer("Tom"))
+	}
+}
+
+func TestConsistency_Weighted(t *testing.T) {
+	c := New(50, nil)
+	c.RegisterWeighted("small", 1)
+	c.RegisterWeighted("large", 8)
+	if len(c.peers["large"]) != 400 || c.Weight("large") != 8 {
+		t.Fatalf("Actual: %d %d\tExpect: 400 8", len(c.peers["large"]), c.Weight("large"))
+	}
+	dist := c.Distribution()
+	if total := dist["small"] + dist["large"]; total < 0.999 || total > 1.001 {
+		t.Fatalf("Actual: %f\tExpect: 1", total)
+	}
+	// 权重为1:8 大节点拥有的哈希空间应接近8/9
+	if dist["large"] < 0.8 {
+		t.Fatalf("Actual: %f\tExpect: about %f", dist["large"], 8.0/9)
+	}
+	// 修改权重后虚拟节点个数随之变化
+	c.RegisterWeighted("large", 2)
+	if len(c.peers["large"]) != 100 || len(c.ring) != 150 {
+		t.Fatalf("Actual: %d %d\tExpect: 100 150", len(c.peers["large"]), len(c.ring))
+	}
+}
+
+func TestBounded_GetPeer(t *testing.T) {
+	b := NewBounded(50, 0.25, nil)
+	b.Register("peer1", "peer2", "peer3", "peer4")
+	key := "Tom"
+	owner := b.GetPeer(key)
+	if owner != b.Consistentency.GetPeer(key) {
+		t.Fatalf("Actual: %s\tExpect: %s", owner, b.Consistentency.GetPeer(key))
+	}
+	// 同一个热点key持续占用负载 超过上限后溢出到其他节点
+	peers := make(map[string]int64)
+	for i := 0; i < 100; i++ {
+		peer := b.GetPeer(key)
+		b.Begin(peer)
+		peers[peer]++
+	}
+	// 每个节点的负载不超过 ceil(100/4*1.25)=32
+	for peer, load := range peers {
+		if load > 32 {
+			t.Fatalf("peer %s overloaded: %d", peer, load)
+		}
+	}
+	if len(peers) < 4 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(peers), 4)
+	}
+	for peer, load := range peers {
+		for i := int64(0); i < load; i++ {
+			b.End(peer)
+		}
+	}
+	if peer := b.GetPeer(key); peer != owner {
+		t.Fatalf("Actual: %s\tExpect: %s", peer, owner)
+	}
+}
@@ -0,0 +1,91 @@
+package consistenthash
+
+import "hash/crc32"
+
+// Jump 一致性跳跃哈希(jump consistent hash) 把key映射到 [0,n) 的桶上 不占用额外内存 查找为 O(ln n)
+// 桶按节点名称排序 带权重的节点占用多个连续的桶
+// 只有在排序后位于末尾的节点增删时迁移量最小 删除中间的节点会导致更多key迁移
+type Jump struct {
+	weightedPeers
+	hash    HashFunc
+	buckets []string // 桶 -> 节点
+}
+
+// NewJump 创建跳跃哈希 fn为nil时使用 crc32.ChecksumIEEE
+func NewJump(fn HashFunc) *Jump {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Jump{weightedPeers: newWeightedPeers(), hash: fn}
+}
+
+func (j *Jump) Register(peersName ...string) {
+	changed := false
+	for _, peerName := range peersName {
+		if !j.Has(peerName) {
+			changed = j.set(peerName, 1) || changed
+		}
+	}
+	if changed {
+		j.build()
+	}
+}
+
+func (j *Jump) RegisterWeighted(peerName string, weight int) {
+	if j.set(peerName, weight) {
+		j.build()
+	}
+}
+
+func (j *Jump) Remove(peersName ...string) {
+	if j.remove(peersName...) {
+		j.build()
+	}
+}
+
+// 按节点名称和权重重建桶
+func (j *Jump) build() {
+	j.buckets = j.buckets[:0]
+	for _, peerName := range j.names {
+		for i := 0; i < j.weights[peerName]; i++ {
+			j.buckets = append(j.buckets, peerName)
+		}
+	}
+}
+
+func (j *Jump) GetPeer(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.buckets))]
+}
+
+// GetPeers 第一个节点与 GetPeer 相同 之后依次用 key 的哈希值加上序号重新计算桶 直到得到n个不同的节点
+func (j *Jump) GetPeers(key string, n int) []string {
+	if len(j.buckets) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.names) {
+		n = len(j.names)
+	}
+	h := uint64(j.hash([]byte(key)))
+	peers := make([]string, 0, n)
+	for i := uint64(0); len(peers) < n; i++ {
+		peer := j.buckets[jumpHash(mix64(h+i*0x9e3779b97f4a7c15), len(j.buckets))]
+		if !containsPeer(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// Lamping 和 Veach 的跳跃一致性哈希算法
+func jumpHash(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
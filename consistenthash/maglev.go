@@ -0,0 +1,150 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"strconv"
+)
+
+// Maglev 默认查找表大小 需要是远大于节点数的质数
+const defaultMaglevTableSize = 65537
+
+// Maglev 是Google Maglev负载均衡器中的一致性哈希 每个节点按自己的排列轮流填充查找表
+// 查找为 O(1) 节点之间的负载非常均衡 节点增删时需要重建查找表 迁移量略大于哈希环
+type Maglev struct {
+	weightedPeers
+	hash   HashFunc
+	size   int      // 查找表大小
+	lookup []string // 查找表 下标 -> 节点
+}
+
+// NewMaglev 创建Maglev哈希 size为查找表大小 <=0时使用65537 fn为nil时使用 crc32.ChecksumIEEE
+// size不是质数时向上取到最近的质数 否则节点的排列不能遍历查找表 节点数超过size时重建查找表会扩大size
+func NewMaglev(size int, fn HashFunc) *Maglev {
+	if size <= 0 {
+		size = defaultMaglevTableSize
+	}
+	size = nextPrime(size)
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Maglev{weightedPeers: newWeightedPeers(), hash: fn, size: size}
+}
+
+func (m *Maglev) Register(peersName ...string) {
+	changed := false
+	for _, peerName := range peersName {
+		if !m.Has(peerName) {
+			changed = m.set(peerName, 1) || changed
+		}
+	}
+	if changed {
+		m.build()
+	}
+}
+
+func (m *Maglev) RegisterWeighted(peerName string, weight int) {
+	if m.set(peerName, weight) {
+		m.build()
+	}
+}
+
+// RegisterAll 一次添加多个带权重的节点 结果与逐个调用 RegisterWeighted 相同 查找表只重建一次
+func (m *Maglev) RegisterAll(weights map[string]int) {
+	changed := false
+	for peerName, weight := range weights {
+		changed = m.set(peerName, weight) || changed
+	}
+	if changed {
+		m.build()
+	}
+}
+
+func (m *Maglev) Remove(peersName ...string) {
+	if m.remove(peersName...) {
+		m.build()
+	}
+}
+
+// 重建查找表 每轮每个节点按权重依次占用自己排列中下一个空位 直到查找表填满
+func (m *Maglev) build() {
+	n := len(m.names)
+	if n == 0 {
+		m.lookup = nil
+		return
+	}
+	// 查找表小于节点数时 有的节点分不到位置
+	if m.size < n {
+		m.size = nextPrime(n)
+	}
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	next := make([]uint64, n)
+	for i, peerName := range m.names {
+		offsets[i] = mix64(uint64(m.hash([]byte(peerName)))) % uint64(m.size)
+		skips[i] = mix64(uint64(m.hash([]byte(peerName+"#"+strconv.Itoa(m.size)))))%uint64(m.size-1) + 1
+	}
+	lookup := make([]string, m.size)
+	filled := 0
+	for filled < m.size {
+		for i, peerName := range m.names {
+			for w := 0; w < m.weights[peerName] && filled < m.size; w++ {
+				// 找到该节点排列中下一个空位
+				for {
+					slot := (offsets[i] + next[i]*skips[i]) % uint64(m.size)
+					next[i]++
+					if lookup[slot] == "" {
+						lookup[slot] = peerName
+						filled++
+						break
+					}
+				}
+			}
+		}
+	}
+	m.lookup = lookup
+}
+
+func (m *Maglev) GetPeer(key string) string {
+	if len(m.lookup) == 0 {
+		return ""
+	}
+	return m.lookup[mix64(uint64(m.hash([]byte(key))))%uint64(m.size)]
+}
+
+// GetPeers 从key在查找表中的位置向后找到n个不同的节点
+func (m *Maglev) GetPeers(key string, n int) []string {
+	if len(m.lookup) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.names) {
+		n = len(m.names)
+	}
+	idx := mix64(uint64(m.hash([]byte(key)))) % uint64(m.size)
+	peers := make([]string, 0, n)
+	for i := uint64(0); i < uint64(m.size) && len(peers) < n; i++ {
+		peer := m.lookup[(idx+i)%uint64(m.size)]
+		if !containsPeer(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// 返回不小于n的最小质数 n<2时返回2
+func nextPrime(n int) int {
+	if n < 2 {
+		return 2
+	}
+	for ; ; n++ {
+		prime := true
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
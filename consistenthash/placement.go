@@ -0,0 +1,129 @@
+package consistenthash
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Placement 决定key归属于哪个节点 server通过它选择节点
+// 除了哈希环 Consistentency 之外 还提供 Rendezvous(HRW) Jump 和 Maglev 三种实现
+// 实现不需要是并发安全的 由调用者加锁
+type Placement interface {
+	// Register 添加权重为1的节点 已存在的节点会被忽略
+	Register(peersName ...string)
+	// RegisterWeighted 添加带权重的节点 节点拥有的key与权重成正比 节点已存在且权重不同时更新权重
+	RegisterWeighted(peerName string, weight int)
+	// Remove 删除节点
+	Remove(peersName ...string)
+	// Has 判断节点是否存在
+	Has(peerName string) bool
+	// Peers 返回所有节点 按名称排序
+	Peers() []string
+	// Weight 返回节点的权重 节点不存在时返回0
+	Weight(peerName string) int
+	// GetPeer 返回key归属的节点 没有节点时返回空字符串
+	GetPeer(key string) string
+	// GetPeers 返回key的n个不同的归属节点 第一个与 GetPeer 相同 其余按优先级排列 节点不足n个时返回全部节点
+	GetPeers(key string, n int) []string
+}
+
+// BatchRegisterer 可选接口 一次添加多个带权重的节点 结果与逐个调用 RegisterWeighted 相同
+// 只重建一次环或查找表 Consistentency Bounded 和 Maglev 实现了该接口
+type BatchRegisterer interface {
+	RegisterAll(weights map[string]int)
+}
+
+// RegisterAll 添加多个带权重的节点 p实现了 BatchRegisterer 时一次添加 否则逐个调用 RegisterWeighted
+func RegisterAll(p Placement, weights map[string]int) {
+	if b, ok := p.(BatchRegisterer); ok {
+		b.RegisterAll(weights)
+		return
+	}
+	for peerName, weight := range weights {
+		p.RegisterWeighted(peerName, weight)
+	}
+}
+
+var (
+	_ BatchRegisterer = (*Consistentency)(nil)
+	_ BatchRegisterer = (*Bounded)(nil)
+	_ BatchRegisterer = (*Maglev)(nil)
+
+	_ Placement = (*Consistentency)(nil)
+	_ Placement = (*Bounded)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*Jump)(nil)
+	_ Placement = (*Maglev)(nil)
+)
+
+// Distribution 用n个样本key估计每个节点拥有的key的比例 适用于任意 Placement
+func Distribution(p Placement, n int) map[string]float64 {
+	dist := make(map[string]float64)
+	if n <= 0 {
+		return dist
+	}
+	for i := 0; i < n; i++ {
+		if peer := p.GetPeer("sample-" + strconv.Itoa(i)); peer != "" {
+			dist[peer] += 1 / float64(n)
+		}
+	}
+	return dist
+}
+
+// weightedPeers 记录节点及其权重 供 Rendezvous Jump Maglev 复用
+type weightedPeers struct {
+	weights map[string]int // 节点 -> 权重
+	names   []string       // 按名称排序的节点
+}
+
+func newWeightedPeers() weightedPeers {
+	return weightedPeers{weights: make(map[string]int)}
+}
+
+// 添加或更新节点 返回节点集合是否发生变化
+func (w *weightedPeers) set(peerName string, weight int) bool {
+	if weight <= 0 {
+		weight = 1
+	}
+	old, ok := w.weights[peerName]
+	if ok && old == weight {
+		return false
+	}
+	w.weights[peerName] = weight
+	if !ok {
+		idx := sort.SearchStrings(w.names, peerName)
+		w.names = append(w.names, "")
+		copy(w.names[idx+1:], w.names[idx:])
+		w.names[idx] = peerName
+	}
+	return true
+}
+
+// 删除节点 返回节点集合是否发生变化
+func (w *weightedPeers) remove(peersName ...string) bool {
+	changed := false
+	for _, peerName := range peersName {
+		if _, ok := w.weights[peerName]; !ok {
+			continue
+		}
+		delete(w.weights, peerName)
+		w.names = removePeer(w.names, peerName)
+		changed = true
+	}
+	return changed
+}
+
+func (w *weightedPeers) Has(peerName string) bool {
+	_, ok := w.weights[peerName]
+	return ok
+}
+
+func (w *weightedPeers) Peers() []string {
+	peers := make([]string, len(w.names))
+	copy(peers, w.names)
+	return peers
+}
+
+func (w *weightedPeers) Weight(peerName string) int {
+	return w.weights[peerName]
+}
@@ -0,0 +1,183 @@
+package consistenthash
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+var placements = map[string]func() Placement{
+	"ring":       func() Placement { return New(50, nil) },
+	"rendezvous": func() Placement { return NewRendezvous(nil) },
+	"jump":       func() Placement { return NewJump(nil) },
+	"maglev":     func() Placement { return NewMaglev(0, nil) },
+}
+
+const (
+	testPeers = 10
+	testKeys  = 20000
+)
+
+func registerPeers(p Placement, n int) {
+	for i := 0; i < n; i++ {
+		p.Register("127.0.0.1:" + strconv.Itoa(6000+i))
+	}
+}
+
+// 最多的节点拥有的key个数与平均个数之比 越接近1越均衡
+func imbalance(p Placement) float64 {
+	counts := make(map[string]int)
+	for i := 0; i < testKeys; i++ {
+		counts[p.GetPeer(strconv.Itoa(i))]++
+	}
+	max := 0
+	for _, count := range counts {
+		if count > max {
+			max = count
+		}
+	}
+	return float64(max) / (float64(testKeys) / float64(len(counts)))
+}
+
+// 节点变化后归属发生变化的key的比例
+func remapRatio(p Placement, change func(Placement)) float64 {
+	before := make([]string, testKeys)
+	for i := range before {
+		before[i] = p.GetPeer(strconv.Itoa(i))
+	}
+	change(p)
+	moved := 0
+	for i, peer := range before {
+		if p.GetPeer(strconv.Itoa(i)) != peer {
+			moved++
+		}
+	}
+	return float64(moved) / testKeys
+}
+
+func TestPlacement_Balance(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		registerPeers(p, testPeers)
+		ratio := imbalance(p)
+		t.Logf("%-10s max/avg = %.3f", name, ratio)
+		if ratio > 1.5 {
+			t.Errorf("%s is unbalanced: max/avg = %.3f", name, ratio)
+		}
+	}
+}
+
+func TestPlacement_Remap(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		registerPeers(p, testPeers)
+		join := remapRatio(p, func(p Placement) { p.Register("127.0.0.1:7000") })
+		leave := remapRatio(p, func(p Placement) { p.Remove("127.0.0.1:7000") })
+		t.Logf("%-10s join remap = %.3f, leave remap = %.3f", name, join, leave)
+		// 理想的迁移比例为 1/11 允许一定的误差
+		if join > 0.2 || leave > 0.2 {
+			t.Errorf("%s remaps too many keys: join %.3f leave %.3f", name, join, leave)
+		}
+	}
+}
+
+func TestPlacement_Weighted(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		p.RegisterWeighted("small", 1)
+		p.RegisterWeighted("large", 3)
+		dist := Distribution(p, testKeys)
+		t.Logf("%-10s large = %.3f", name, dist["large"])
+		if dist["large"] < 0.65 || dist["large"] > 0.85 {
+			t.Errorf("%s: Actual: %.3f\tExpect: about 0.75", name, dist["large"])
+		}
+		p.Remove("large")
+		if p.Has("large") || p.GetPeer("Tom") != "small" {
+			t.Errorf("%s: remove large failed", name)
+		}
+	}
+}
+
+func TestPlacement_GetPeers(t *testing.T) {
+	for name, newPlacement := range placements {
+		p := newPlacement()
+		registerPeers(p, 5)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			peers := p.GetPeers(key, 3)
+			if len(peers) != 3 || peers[0] != p.GetPeer(key) {
+				t.Fatalf("%s: GetPeers(%s) = %v, GetPeer = %s", name, key, peers, p.GetPeer(key))
+			}
+			if peers[0] == peers[1] || peers[0] == peers[2] || peers[1] == peers[2] {
+				t.Fatalf("%s: GetPeers(%s) = %v, peers should be distinct", name, key, peers)
+			}
+		}
+		if peers := p.GetPeers("Tom", 10); len(peers) != 5 {
+			t.Errorf("%s: Actual: %d\tExpect: 5", name, len(peers))
+		}
+	}
+}
+
+// 查找表大小不是质数或小于节点数时 不能卡住或panic 每个节点都能分到位置
+func TestMaglev_TableSize(t *testing.T) {
+	for _, size := range []int{1, 4, 100} {
+		done := make(chan *Maglev)
+		go func() {
+			m := NewMaglev(size, nil)
+			m.Register("a", "b", "c")
+			done <- m
+		}()
+		select {
+		case m := <-done:
+			owned := make(map[string]bool)
+			for _, peer := range m.lookup {
+				owned[peer] = true
+			}
+			if len(owned) != 3 {
+				t.Errorf("size %d: table %d owned by %v", size, m.size, owned)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("size %d: build did not finish", size)
+		}
+	}
+}
+
+func benchmarkGetPeer(b *testing.B, p Placement) {
+	registerPeers(p, testPeers)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.GetPeer(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkRing_GetPeer(b *testing.B)       { benchmarkGetPeer(b, New(50, nil)) }
+func BenchmarkRendezvous_GetPeer(b *testing.B) { benchmarkGetPeer(b, NewRendezvous(nil)) }
+func BenchmarkJump_GetPeer(b *testing.B)       { benchmarkGetPeer(b, NewJump(nil)) }
+func BenchmarkMaglev_GetPeer(b *testing.B)     { benchmarkGetPeer(b, NewMaglev(0, nil)) }
+
+// 一次添加多个节点与逐个添加的结果相同 包括修改已有节点的权重
+func TestPlacement_RegisterAll(t *testing.T) {
+	weights := map[string]int{"a": 1, "b": 3, "c": 2}
+	for name, newPlacement := range placements {
+		one, all := newPlacement(), newPlacement()
+		one.RegisterWeighted("b", 1)
+		all.RegisterWeighted("b", 1)
+		for _, peer := range []string{"a", "b", "c"} {
+			one.RegisterWeighted(peer, weights[peer])
+		}
+		RegisterAll(all, weights)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			if one.GetPeer(key) != all.GetPeer(key) {
+				t.Fatalf("%s: key %s placed on %s and %s", name, key, one.GetPeer(key), all.GetPeer(key))
+			}
+		}
+		if all.Weight("b") != 3 {
+			t.Fatalf("%s: weight of b = %d, want 3", name, all.Weight("b"))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous 最高随机权重哈希(HRW) 对每个节点计算 key+节点 的得分 得分最高的节点拥有该key
+// 节点增删时只有属于该节点的key需要迁移 不需要虚拟节点 代价是每次查找需要遍历所有节点
+type Rendezvous struct {
+	weightedPeers
+	hash HashFunc
+}
+
+// NewRendezvous 创建HRW哈希 fn为nil时使用 crc32.ChecksumIEEE
+func NewRendezvous(fn HashFunc) *Rendezvous {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{weightedPeers: newWeightedPeers(), hash: fn}
+}
+
+func (r *Rendezvous) Register(peersName ...string) {
+	for _, peerName := range peersName {
+		if !r.Has(peerName) {
+			r.set(peerName, 1)
+		}
+	}
+}
+
+func (r *Rendezvous) RegisterWeighted(peerName string, weight int) {
+	r.set(peerName, weight)
+}
+
+func (r *Rendezvous) Remove(peersName ...string) {
+	r.remove(peersName...)
+}
+
+func (r *Rendezvous) GetPeer(key string) string {
+	var best string
+	bestScore := math.Inf(-1)
+	for _, peerName := range r.names {
+		if score := r.score(peerName, key); score > bestScore {
+			best, bestScore = peerName, score
+		}
+	}
+	return best
+}
+
+// GetPeers 返回得分最高的n个节点 按得分从高到低排列
+func (r *Rendezvous) GetPeers(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	peers := make([]string, len(r.names))
+	copy(peers, r.names)
+	scores := make(map[string]float64, len(peers))
+	for _, peerName := range peers {
+		scores[peerName] = r.score(peerName, key)
+	}
+	sort.SliceStable(peers, func(i, j int) bool { return scores[peers[i]] > scores[peers[j]] })
+	if n < len(peers) {
+		peers = peers[:n]
+	}
+	return peers
+}
+
+// 带权重的得分 weight / -ln(u) u是 (0,1) 上均匀分布的哈希值
+// 节点被选中的概率与权重成正比
+func (r *Rendezvous) score(peerName string, key string) float64 {
+	h := mix64(uint64(r.hash([]byte(key + "\x00" + peerName))))
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return float64(r.weights[peerName]) / -math.Log(u)
+}
+
+// splitmix64 的混淆函数 把32位哈希值扩散到64位
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
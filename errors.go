@@ -0,0 +1,139 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 可以用 errors.Is 判断的错误 在节点之间传递时保持不变
+var (
+	ErrEmptyKey         = errors.New("gocache: key is required")
+	ErrNotFound         = errors.New("gocache: not found")
+	ErrGroupNotFound    = errors.New("gocache: group not found")
+	ErrRetrieverFailed  = errors.New("gocache: retriever failed")
+	ErrPeerUnavailable  = errors.New("gocache: peer unavailable")
+	ErrUnauthenticated  = errors.New("gocache: unauthenticated")
+	ErrPermissionDenied = errors.New("gocache: permission denied")
+)
+
+// 错误在grpc status的ErrorInfo中的domain
+const errorDomain = "gocache"
+
+// 错误与grpc状态码的对应关系 reason 写入 ErrorInfo 用于区分状态码相同的错误
+var errorCodes = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{ErrEmptyKey, codes.InvalidArgument, "EMPTY_KEY"},
+	{ErrNotFound, codes.NotFound, "NOT_FOUND"},
+	{ErrGroupNotFound, codes.NotFound, "GROUP_NOT_FOUND"},
+	{ErrRetrieverFailed, codes.Internal, "RETRIEVER_FAILED"},
+	{ErrPeerUnavailable, codes.Unavailable, "PEER_UNAVAILABLE"},
+	{ErrUnauthenticated, codes.Unauthenticated, "UNAUTHENTICATED"},
+	{ErrPermissionDenied, codes.PermissionDenied, "PERMISSION_DENIED"},
+}
+
+// 没有ErrorInfo时 按状态码还原的错误 如拦截器和grpc自身返回的错误
+var codeErrors = map[codes.Code]error{
+	codes.Unavailable:      ErrPeerUnavailable,
+	codes.Unauthenticated:  ErrUnauthenticated,
+	codes.PermissionDenied: ErrPermissionDenied,
+	codes.DeadlineExceeded: context.DeadlineExceeded,
+	codes.Canceled:         context.Canceled,
+}
+
+// 包装retriever返回的错误 使其可以用 ErrRetrieverFailed 判断 同时保留原来的错误
+// retriever返回 ErrNotFound 或ctx的错误时原样返回
+func retrieverError(err error) error {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrRetrieverFailed, err)
+}
+
+// 返回err对应的reason 不是gocache的错误时返回空字符串
+func errorReason(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.reason
+		}
+	}
+	return ""
+}
+
+// 将rpc方法返回的错误转换为grpc status 客户端可以用 fromStatus 还原
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range errorCodes {
+		if !errors.Is(err, e.err) {
+			continue
+		}
+		st := status.New(e.code, err.Error())
+		if detailed, derr := st.WithDetails(&errdetails.ErrorInfo{Domain: errorDomain, Reason: e.reason}); derr == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// 还原rpc返回的错误 使调用者可以用 errors.Is 判断 不是grpc status的错误原样返回
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+	var sentinel error
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == errorDomain {
+			sentinel = reasonError(info.GetReason())
+		}
+	}
+	if sentinel == nil {
+		sentinel = codeErrors[st.Code()]
+	}
+	if sentinel == nil {
+		return err
+	}
+	return &remoteError{msg: st.Message(), err: sentinel, status: st}
+}
+
+// 返回reason对应的错误 未知的reason返回nil
+func reasonError(reason string) error {
+	for _, e := range errorCodes {
+		if e.reason == reason {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// 远端节点返回的错误 保留远端的错误信息 可以用 errors.Is 判断
+type remoteError struct {
+	msg    string
+	err    error
+	status *status.Status // 为nil时不是由grpc status还原的 如批量获取中单个key的错误
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+func (e *remoteError) Unwrap() error { return e.err }
+
+// GRPCStatus 使 status.Code 仍然可以得到原来的状态码
+func (e *remoteError) GRPCStatus() *status.Status {
+	if e.status == nil {
+		return status.New(codes.Unknown, e.msg)
+	}
+	return e.status
+}
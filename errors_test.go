@@ -0,0 +1,60 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	pb "github.com/neijuanxiaozi/gocache/gocachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrors_StatusRoundTrip(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	cases := []struct {
+		err  error
+		code codes.Code
+		want error
+	}{
+		{ErrEmptyKey, codes.InvalidArgument, ErrEmptyKey},
+		{fmt.Errorf("%w: Tom", ErrNotFound), codes.NotFound, ErrNotFound},
+		{fmt.Errorf("%w: scores", ErrGroupNotFound), codes.NotFound, ErrGroupNotFound},
+		{retrieverError(dbErr), codes.Internal, ErrRetrieverFailed},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, context.DeadlineExceeded},
+	}
+	for _, c := range cases {
+		st := toStatus(c.err)
+		if status.Code(st) != c.code {
+			t.Errorf("toStatus(%v) code = %v, want %v", c.err, status.Code(st), c.code)
+		}
+		got := fromStatus(st)
+		if !errors.Is(got, c.want) || got.Error() != c.err.Error() {
+			t.Errorf("fromStatus(toStatus(%v)) = %v", c.err, got)
+		}
+		if status.Code(got) != c.code {
+			t.Errorf("status code of %v = %v, want %v", got, status.Code(got), c.code)
+		}
+	}
+	// 没有ErrorInfo时按状态码还原
+	if err := fromStatus(status.Error(codes.PermissionDenied, "denied")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("PermissionDenied = %v", err)
+	}
+	if err := fromStatus(status.Error(codes.Unknown, "boom")); errors.Is(err, ErrRetrieverFailed) || err.Error() != "rpc error: code = Unknown desc = boom" {
+		t.Errorf("Unknown = %v", err)
+	}
+
+	// retriever的错误同时可以用原来的错误判断
+	if err := retrieverError(dbErr); !errors.Is(err, ErrRetrieverFailed) || !errors.Is(err, dbErr) {
+		t.Errorf("retrieverError = %v", err)
+	}
+	if err := retrieverError(ErrNotFound); err != ErrNotFound {
+		t.Errorf("retrieverError(ErrNotFound) = %v", err)
+	}
+
+	item := &pb.BatchGetItem{Key: "Tom", Error: "gocache: not found: Tom", Reason: errorReason(fmt.Errorf("%w: Tom", ErrNotFound))}
+	if err := itemError(item); !errors.Is(err, ErrNotFound) || err.Error() != item.Error {
+		t.Errorf("itemError = %v", err)
+	}
+}
@@ -11,32 +11,70 @@
 package gocache
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"math/rand"
 	"sync"
+	"time"
 
+	"github.com/neijuanxiaozi/gocache/logger"
 	"github.com/neijuanxiaozi/gocache/singleflight"
 )
 
+const (
+	defaultHotCacheRatio    = 8                // 热点缓存默认占用主缓存1/8的内存
+	defaultReplicateTimeout = 10 * time.Second // 在后台写入其他副本的超时时间
+	defaultSpillTTL         = time.Second      // 溢出到非副本节点的值在热点缓存中的过期时长
+)
+
 var (
 	mu     sync.RWMutex              // 全局变量 groups 的读写锁
 	groups = make(map[string]*Group) // 全局变量 groups
 )
 
-// 定义接口 参数是string 返回值是[]byte
-// 当从缓存中获取数据失败时的回调函数 用于从源获取数据
-type Retriever interface {
-	retrieve(key string) ([]byte, error)
+// Loader 当从缓存中获取数据失败时 用于从源获取数据
+// 导出的接口 外部包可以用结构体(数据库客户端 带状态的HTTP客户端等)实现 并传给 NewGroup
+type Loader interface {
+	Load(ctx context.Context, key string) ([]byte, error)
 }
 
-// 定义函数类型 RetrieverFunc，并实现 Retriever 接口的 retrieve 方法。
+// TTLLoader 可选接口 在返回源数据的同时返回该key的过期时长
+// 实现了该接口的 Loader 可以为每个key单独指定过期时长 过期时长<=0时使用 Group 的默认过期时长
+type TTLLoader interface {
+	Loader
+	LoadTTL(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// Retriever 是 Loader 的别名 保留原有名称以兼容已有代码
+type Retriever = Loader
+
+// 定义函数类型 RetrieverFunc，并实现 Loader 接口的 Load 方法。
 type RetrieverFunc func(key string) ([]byte, error)
 
 // 函数类型实现某一个接口，称之为接口型函数，方便使用者在调用时既能够传入函数作为参数，
 // 也能够传入实现了该接口的结构体作为参数。
 // 定义一个函数类型 F，并且实现接口 A 的方法，然后在这个方法中调用自己。
 // 这是 Go 语言中将其他函数（参数返回值定义与 F 一致）转换为接口 A 的常用技巧。
-func (f RetrieverFunc) retrieve(key string) ([]byte, error) {
+func (f RetrieverFunc) Load(ctx context.Context, key string) ([]byte, error) {
+	return f(key)
+}
+
+// 定义函数类型 RetrieverFuncCtx 回调函数可以感知调用者的ctx 在超时或取消时及时返回
+type RetrieverFuncCtx func(ctx context.Context, key string) ([]byte, error)
+
+func (f RetrieverFuncCtx) Load(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// 定义函数类型 RetrieverTTLFunc 返回源数据和该key的过期时长 过期时长<=0时使用 Group 的默认过期时长
+type RetrieverTTLFunc func(key string) ([]byte, time.Duration, error)
+
+func (f RetrieverTTLFunc) Load(ctx context.Context, key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
+func (f RetrieverTTLFunc) LoadTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
 	return f(key)
 }
 
@@ -45,28 +83,92 @@ func (f RetrieverFunc) retrieve(key string) ([]byte, error) {
 type Group struct {
 	name      string               // 每个 Group 拥有一个唯一的名称 name
 	cache     *cache               // 即一开始实现的并发缓存
-	retriever Retriever            // 即缓存未命中时获取源数据的回调(callback)
+	retriever Loader               // 即缓存未命中时获取源数据的回调(callback)
 	server    Picker               // 将实现了 PeerPicker 接口的 HTTPPool(网络模块) 注入到 Group 中
 	flight    *singleflight.Flight // 请求锁 保证同一个key的请求在同一时间只有一个 减少请求数量
+	ttl       time.Duration        // 缓存值默认的过期时长 0表示永不过期
+	// 每个key保存在几个节点上 <=1表示只保存在所属节点上
+	replication int
+	// 热点缓存 保存一部分从远程节点获取的值 避免热点key的每次请求都访问所属节点
+	hotCache *cache
+	// 从远程节点获取的值被放入热点缓存的概率 <=0表示不使用热点缓存
+	hotRate float64
+	// 墓碑缓存 记录回调函数返回 ErrNotFound 的key 避免反复访问源数据
+	negCache *cache
+	// 墓碑的过期时长 <=0表示不缓存不存在的key
+	negativeTTL time.Duration
+	// 软过期时长 超过后命中时返回旧值并在后台刷新 <=0表示不使用
+	softTTL time.Duration
+	// 在软过期(没有时为硬过期)之前多久开始在命中时后台刷新 <=0表示不提前
+	refreshAhead time.Duration
+	// 正在后台刷新的key 保证同一个key同时只有一个后台刷新
+	refreshing sync.Map
+	// 后台刷新使用的ctx Close时取消
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+	// 保护closed 保证 Close 之后不再启动后台刷新
+	bgMu   sync.Mutex
+	closed bool
+	// 进行中的后台刷新 Close时等待其结束
+	bgWG sync.WaitGroup
+	// 统计信息
+	stats groupStats
+	// 日志 默认使用创建时 SetLogger 设置的 Logger
+	logger Logger
+}
+
+// 按主缓存的1/ratio计算附属缓存的最大内存 主缓存不限制内存时同样不限制
+// 主缓存较小时结果至少为1 避免得到表示不限制内存的0
+func ratioBytes(maxBytes int64, ratio int64) int64 {
+	if maxBytes <= 0 {
+		return maxBytes
+	}
+	return max(maxBytes/ratio, 1)
 }
 
 // 构建函数 NewGroup 用来实例化 Group，并且将 group 存储在全局变量 groups 中
-func NewGroup(name string, maxBytes int64, retriever Retriever) *Group {
+// opts 可以设置过期时长 淘汰策略 热点缓存 副本数等 如 NewGroup(name, maxBytes, retriever, WithTTL(time.Minute))
+func NewGroup(name string, maxBytes int64, retriever Loader, opts ...GroupOption) *Group {
 	if retriever == nil {
 		panic("Retriver is nil.")
 	}
+	o := defaultGroupOptions()
+	for _, opt := range opts {
+		opt.applyGroup(&o)
+	}
+	if o.hotBytes < 0 {
+		o.hotBytes = ratioBytes(maxBytes, defaultHotCacheRatio)
+	}
+	if o.negativeBytes < 0 {
+		o.negativeBytes = ratioBytes(maxBytes, defaultNegativeCacheRatio)
+	}
 	g := &Group{
-		name:      name,
-		cache:     newCache(maxBytes),
-		retriever: retriever,
-		flight:    &singleflight.Flight{},
+		name:         name,
+		cache:        newCache(maxBytes, o),
+		retriever:    retriever,
+		flight:       &singleflight.Flight{},
+		ttl:          o.ttl,
+		hotCache:     newCache(o.hotBytes, o),
+		hotRate:      o.hotRate,
+		negCache:     newCache(o.negativeBytes, o),
+		negativeTTL:  o.negativeTTL,
+		softTTL:      o.softTTL,
+		refreshAhead: o.refreshAhead,
+		logger:       o.logger,
 	}
+	g.bgCtx, g.bgCancel = context.WithCancel(context.Background())
+	g.SetReplication(o.replication)
 	mu.Lock()
 	groups[name] = g
 	mu.Unlock()
 	return g
 }
 
+// NewGroupWithTTL 实例化一个缓存值默认在ttl后过期的 Group 等同于 NewGroup(name, maxBytes, retriever, WithTTL(ttl))
+func NewGroupWithTTL(name string, maxBytes int64, ttl time.Duration, retriever Loader, opts ...GroupOption) *Group {
+	return NewGroup(name, maxBytes, retriever, append([]GroupOption{WithTTL(ttl)}, opts...)...)
+}
+
 // 获取名字对应的group
 func GetGroup(name string) *Group {
 	mu.RLock()
@@ -75,15 +177,38 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// DestoryGroup 关闭名字对应的group 并停止它注册的server(如果server实现了Stop)
+// 同一个server被多个group共用时 应使用 Group.Close 只关闭group
 func DestoryGroup(name string) {
 	g := GetGroup(name)
-	if g != nil {
-		server := g.server.(*server)
-		server.Stop()
-		delete(groups, name)
-		log.Printf("Destory cache [%s %s]", name, server.addr)
+	if g == nil {
+		return
+	}
+	g.Close()
+	if stopper, ok := g.server.(interface{ Stop() }); ok {
+		stopper.Stop()
 	}
+	g.logger.Info("group destroyed", "group", name)
+}
 
+// Close 将group从全局变量 groups 中移除 取消并等待进行中的后台刷新 停止缓存的后台清理协程
+// 不会停止group注册的server 其他节点对该group的请求将返回group不存在 可以重复调用
+func (g *Group) Close() {
+	mu.Lock()
+	// 同名的group可能已经被重新创建 只移除自己
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	mu.Unlock()
+	// 取消并等待进行中的后台刷新 之后不再启动新的刷新
+	g.bgMu.Lock()
+	g.closed = true
+	g.bgMu.Unlock()
+	g.bgCancel()
+	g.bgWG.Wait()
+	g.cache.close()
+	g.hotCache.close()
+	g.negCache.close()
 }
 
 // Get 方法实现了上述所说的流程 ⑴ 和 ⑶。
@@ -91,35 +216,101 @@ func DestoryGroup(name string) {
 // 流程 ⑶ ：缓存不存在，则调用 load 方法，load 调用 getLocally（分布式场景下会调用 getFromPeer 从其他节点获取），
 // getLocally 调用用户回调函数 g.getter.Get() 获取源数据，并且将源数据添加到缓存 mainCache 中（通过 populateCache 方法）
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同 但会将ctx传递给远程节点和回调函数 ctx超时或取消时尽快返回
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	// key为空
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, ErrEmptyKey
 	}
+	g.stats.gets.Add(1)
 	//缓存命中
 	if v, ok := g.cache.get(key); ok {
-		log.Println("[GoCache] hit")
+		if debugEnabled(g.logger) {
+			g.logger.Debug("cache hit", "group", g.name, "key_hash", logger.KeyHash(key))
+		}
+		g.stats.localHits.Add(1)
+		g.maybeRefresh(key, v)
+		return v, nil
+	}
+	// 热点缓存命中
+	if v, ok := g.hotCache.get(key); ok {
+		g.stats.hotHits.Add(1)
 		return v, nil
 	}
+	// 不久前确认过key不存在
+	if g.tombstoned(key) {
+		return ByteView{}, notFound(key)
+	}
 	// 缓存未命中 去获取源数据
-	return g.load(key)
+	g.stats.misses.Add(1)
+	return g.load(ctx, key)
+}
+
+// 处理其他节点发来的 Get 请求 请求方已经选定本节点(可能是有界负载溢出到本节点)
+// 未命中时直接从本地源获取 不再转发 也避免节点间hash环短暂不一致时请求来回转发
+func (g *Group) getForPeer(ctx context.Context, key string) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, ErrEmptyKey
+	}
+	g.stats.gets.Add(1)
+	if v, ok := g.cache.get(key); ok {
+		g.stats.localHits.Add(1)
+		g.maybeRefresh(key, v)
+		return v, nil
+	}
+	// 有界负载时请求可能溢出到本节点 本节点不是副本时不放入主缓存
+	// 否则发往副本节点的 Delete 和 Set 到达不了这里 这里会一直返回旧值 见 getSpilledOnce
+	spill := !g.isReplica(key)
+	if spill {
+		if v, ok := g.hotCache.get(key); ok {
+			g.stats.hotHits.Add(1)
+			return v, nil
+		}
+	}
+	if g.tombstoned(key) {
+		return ByteView{}, notFound(key)
+	}
+	g.stats.misses.Add(1)
+	if spill {
+		return g.getSpilledOnce(ctx, key)
+	}
+	return g.getLocallyOnce(ctx, key)
 }
 
 // 缓存未命中时 用load获取源数据
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
 	// 用loader.Fly去获取数据 保证同时时刻同一个key的请求只有一个
-	view, err := g.flight.Fly(key, func() (interface{}, error) {
-		// 从其他节点缓存获取数据
-		if g.server != nil {
-			if fetcher, ok := g.server.Pick(key); ok {
-				bytes, err := fetcher.Fetch(g.name, key)
-				if err == nil {
-					return ByteView{b: bytes}, nil
-				}
+	view, err := g.flight.Fly(ctx, key, func(ctx context.Context) (interface{}, error) {
+		defer g.observeLoad(time.Now())
+		// 按优先级依次尝试key的副本节点 失败时尝试下一个
+		for _, fetcher := range g.owners(key) {
+			// 本节点是副本之一 从本地源获取数据
+			if fetcher == nil {
+				return g.getLocallyAsOwner(ctx, key)
 			}
-			log.Println("[Gocache] Failed to get from peer", err)
+			view, err := fetcher.Fetch(ctx, g.name, key)
+			if err == nil {
+				g.stats.peerLoads.Add(1)
+				g.mirror(key, view)
+				return view, nil
+			}
+			// 所属节点确认key不存在 不再尝试其他副本 在本地也记录墓碑
+			if errors.Is(err, ErrNotFound) {
+				g.addTombstone(key)
+				return nil, err
+			}
+			g.stats.peerErrors.Add(1)
+			// 调用者已经超时或取消 不再尝试其他副本和本地获取
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			g.logger.Warn("failed to get from peer", "group", g.name, "key_hash", logger.KeyHash(key), "error", err)
 		}
-		// 否则从本地源获取数据
-		return g.getLocally(key)
+		// 所有副本都失败 从本地源获取数据
+		return g.getLocallyAsOwner(ctx, key)
 	})
 	if err == nil {
 		return view.(ByteView), nil
@@ -127,26 +318,291 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+// 记录一次获取数据的耗时
+func (g *Group) observeLoad(start time.Time) {
+	g.stats.loadLatency.observe(time.Since(start))
+}
+
+// 按概率将从远程节点获取的值放入热点缓存 访问越频繁的key越可能被镜像到本地
+func (g *Group) mirror(key string, value ByteView) {
+	if g.hotRate <= 0 || rand.Float64() >= g.hotRate {
+		return
+	}
+	g.hotCache.add(key, value)
+}
+
+// 返回读取key时访问的节点 按优先级排列 nil表示本节点
+// 副本数为1时只返回 Pick 选出的节点(有界负载时可能溢出到其他节点) 否则返回 PickReplicas 选出的副本节点
+func (g *Group) owners(key string) []Fetcher {
+	if g.server == nil {
+		return []Fetcher{nil}
+	}
+	if g.replication > 1 {
+		return g.replicas(key)
+	}
+	if fetcher, ok := g.server.Pick(key); ok {
+		return []Fetcher{fetcher}
+	}
+	return []Fetcher{nil}
+}
+
+// 返回key在哈希环上固定的副本节点 不受有界负载影响 nil表示本节点
+// 写入和删除必须到达这些节点 否则它们会继续返回旧值
+func (g *Group) replicas(key string) []Fetcher {
+	if g.server == nil {
+		return []Fetcher{nil}
+	}
+	if fetchers := g.server.PickReplicas(key, g.replication); len(fetchers) > 0 {
+		return fetchers
+	}
+	return []Fetcher{nil}
+}
+
+// 本节点是否是key的副本节点之一
+func (g *Group) isReplica(key string) bool {
+	for _, fetcher := range g.replicas(key) {
+		if fetcher == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 由 server 实现 有界负载时本节点为自己获取数据也计入本节点的负载 返回的函数结束计数
+type localLoadReporter interface {
+	beginLocalLoad() (end func())
+}
+
+// 本节点负责key时从本地源获取
+func (g *Group) getLocallyAsOwner(ctx context.Context, key string) (ByteView, error) {
+	if r, ok := g.server.(localLoadReporter); ok {
+		defer r.beginLocalLoad()()
+	}
+	return g.getLocally(ctx, key)
+}
+
 // 从本地获取源数据
-func (g *Group) getLocally(key string) (ByteView, error) {
-	// 获取源数据
-	bytes, err := g.retriever.retrieve(key)
-	// 获取源数据失败
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	value, err := g.retrieveView(ctx, key)
+	// 获取源数据失败 key不存在时记录墓碑
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.addTombstone(key)
+		}
 		return ByteView{}, err
 	}
-	// 防止修改 拷贝一份 并返回
-	value := ByteView{b: cloneBytes(bytes)}
-	// 放入缓存中
+	// 放入缓存中 并写入其他副本
 	g.populateCache(key, value)
+	g.replicate(key, value)
 	return value, nil
 }
 
+// 获取源数据 拷贝一份作为缓存值 不放入缓存
+func (g *Group) retrieveView(ctx context.Context, key string) (ByteView, error) {
+	bytes, ttl, err := g.retrieve(ctx, key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return g.newView(bytes, ttl), nil
+}
+
+// 调用回调函数获取源数据 以及该key的过期时长
+func (g *Group) retrieve(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	g.stats.retrieverLoads.Add(1)
+	bytes, ttl, err := loadTTL(ctx, g.retriever, key)
+	if err != nil {
+		g.stats.retrieverErrors.Add(1)
+		err = retrieverError(err)
+	}
+	return bytes, ttl, err
+}
+
+// 根据过期时长计算过期时间 ttl<=0时使用默认过期时长 返回零值表示永不过期
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
 // 将从源数据获取的数据 放入缓存中
 func (g *Group) populateCache(key string, value ByteView) {
 	g.cache.add(key, value)
 }
 
+// Set 写入key对应的值 等同于 SetContext(context.Background(), key, value)
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext 写入key对应的值 写入key的所有副本节点 本节点是副本之一时写入本地缓存
+// 并行写入所有副本 ctx作用于每个远程副本的写入 返回遇到的第一个错误
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	// 本地的热点镜像和墓碑已经是旧值
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	return fanOut(ctx, g.replicas(key), func() {
+		g.setLocally(key, value, 0)
+	}, func(ctx context.Context, fetcher Fetcher) error {
+		return fetcher.Set(ctx, g.name, key, value)
+	})
+}
+
+// Delete 删除key 等同于 DeleteContext(context.Background(), key)
+func (g *Group) Delete(key string) error {
+	return g.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext 从key的所有副本节点删除key 本节点是副本之一时从本地缓存删除
+// 并行删除所有副本 返回遇到的第一个错误
+func (g *Group) DeleteContext(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	return fanOut(ctx, g.replicas(key), func() {
+		g.removeLocally(key)
+	}, func(ctx context.Context, fetcher Fetcher) error {
+		return fetcher.Delete(ctx, g.name, key)
+	})
+}
+
+// Invalidate 使key在整个集群中失效 等同于 InvalidateContext(context.Background(), key)
+func (g *Group) Invalidate(key string) error {
+	return g.InvalidateContext(context.Background(), key)
+}
+
+// InvalidateContext 使key在整个集群中失效 删除本地缓存并并行通知所有远程节点删除
+// 与 Delete 不同 Invalidate 不只作用于key的所属节点 用于清理可能存在于任意节点上的旧值
+func (g *Group) InvalidateContext(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	g.removeLocally(key)
+	if g.server == nil {
+		return nil
+	}
+	return fanOut(ctx, g.server.PickAll(), nil, func(ctx context.Context, fetcher Fetcher) error {
+		return fetcher.Delete(ctx, g.name, key)
+	})
+}
+
+// 对每个节点并行执行remote nil表示本节点 执行local 返回遇到的第一个错误
+func fanOut(ctx context.Context, fetchers []Fetcher, local func(), remote func(ctx context.Context, fetcher Fetcher) error) error {
+	errs := make(chan error, len(fetchers))
+	pending := 0
+	for _, fetcher := range fetchers {
+		if fetcher == nil {
+			if local != nil {
+				local()
+			}
+			continue
+		}
+		pending++
+		go func(fetcher Fetcher) {
+			errs <- remote(ctx, fetcher)
+		}(fetcher)
+	}
+	var firstErr error
+	for ; pending > 0; pending-- {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 副本数>1时 将从源数据获取的值在后台写入其他副本节点 并保留过期时间
+// 所属节点失效后 其他副本可以直接返回该值 不必都从源数据重新获取
+func (g *Group) replicate(key string, value ByteView) {
+	if g.replication <= 1 || g.server == nil {
+		return
+	}
+	for _, fetcher := range g.replicas(key) {
+		if fetcher == nil {
+			continue
+		}
+		go func(fetcher Fetcher) {
+			ctx, cancel := context.WithTimeout(context.Background(), defaultReplicateTimeout)
+			defer cancel()
+			var err error
+			if s, ok := fetcher.(expiringSetter); ok {
+				err = s.setWithExpire(ctx, g.name, key, value.b, value.e)
+			} else {
+				err = fetcher.Set(ctx, g.name, key, value.b)
+			}
+			if err != nil {
+				g.logger.Warn("failed to replicate", "group", g.name, "key_hash", logger.KeyHash(key), "error", err)
+			}
+		}(fetcher)
+	}
+}
+
+// 由 client 实现 写入远程节点时指定过期时间 零值表示使用远程节点的默认过期时长
+type expiringSetter interface {
+	setWithExpire(ctx context.Context, group string, key string, value []byte, expire time.Time) error
+}
+
+// 将值拷贝一份写入本地缓存 ttl<=0时使用默认过期时长
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) {
+	g.negCache.remove(key)
+	g.populateCache(key, g.newView(value, ttl))
+}
+
+// 从本地缓存 热点缓存和墓碑缓存中删除key
+func (g *Group) removeLocally(key string) {
+	g.cache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+}
+
+// SetLogger 设置 Group 使用的 Logger l为nil时不输出日志 需要在使用 Group 之前调用
+func (g *Group) SetLogger(l Logger) {
+	if l == nil {
+		l = logger.Nop()
+	}
+	g.logger = l
+}
+
+// SetReplication 设置每个key的副本数 key会被写入hash环上连续的n个不同节点
+// 读取时按顺序尝试这些节点 某个节点失败时尝试下一个 从源数据获取的值会在后台写入其他副本
+// 需要在使用 Group 之前调用
+func (g *Group) SetReplication(n int) {
+	if n < 1 {
+		n = 1
+	}
+	g.replication = n
+}
+
+// SetHotCache 设置热点缓存的最大内存 以及从远程节点获取的值被放入热点缓存的概率
+// rate<=0 时关闭热点缓存 镜像不会因为其他节点的写入而失效 见 WithHotCache 需要在使用 Group 之前调用
+func (g *Group) SetHotCache(maxBytes int64, rate float64) {
+	g.hotCache.close()
+	g.hotCache = newCache(maxBytes, groupOptions{policy: g.cache.policy, cleanupInterval: g.cache.cleanup})
+	g.hotRate = rate
+}
+
+// CacheStats 返回主缓存 热点缓存或墓碑缓存的统计信息
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.cache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case NegativeCache:
+		return g.negCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
 // 将实现了 Picker 接口的 Server(实现了网络模块的服务端) 注入到 Group 中
 func (g *Group) RegisterSvr(p Picker) {
 	if g.server != nil {
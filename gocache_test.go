@@ -1,5 +1,15 @@
 package gocache
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
 var db = map[string]string{
 	"Tom":  "630",
 	"Jack": "589",
@@ -21,3 +31,710 @@ func main() {
 	// log.Println("gocache is running at", addr)
 	// log.Fatal(http.ListenAndServe(addr, peers))
 }
+
+func TestGroup_SetDelete(t *testing.T) {
+	loadCounts := make(map[string]int)
+	g := NewGroup("set-delete", 2<<10, RetrieverFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	// Set之后的Get应该直接命中缓存 不调用回调函数
+	if err := g.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || v.String() != "700" || loadCounts["Tom"] != 0 {
+		t.Fatalf("get Tom after set failed: %v %s %d", err, v, loadCounts["Tom"])
+	}
+	// Delete之后的Get应该重新调用回调函数获取源数据
+	if err := g.Delete("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" || loadCounts["Tom"] != 1 {
+		t.Fatalf("get Tom after delete failed: %v %s %d", err, v, loadCounts["Tom"])
+	}
+	if err := g.Invalidate("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get("Tom"); err != nil || loadCounts["Tom"] != 2 {
+		t.Fatalf("get Tom after invalidate failed: %v %d", err, loadCounts["Tom"])
+	}
+}
+
+func TestGroup_TTL(t *testing.T) {
+	loadCounts := make(map[string]int)
+	g := NewGroupWithTTL("ttl", 2<<10, time.Hour, RetrieverTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loadCounts[key]++
+			if key == "Sam" {
+				return []byte(db[key]), time.Millisecond, nil
+			}
+			return []byte(db[key]), 0, nil
+		}))
+	if v, err := g.Get("Tom"); err != nil || v.Expire().IsZero() {
+		t.Fatalf("Tom should expire with the default ttl: %v %v", err, v.Expire())
+	}
+	g.Get("Sam")
+	time.Sleep(5 * time.Millisecond)
+	g.Get("Tom")
+	g.Get("Sam")
+	if loadCounts["Tom"] != 1 || loadCounts["Sam"] != 2 {
+		t.Fatalf("Actual: %d %d\tExpect: 1 2", loadCounts["Tom"], loadCounts["Sam"])
+	}
+}
+
+func TestGroup_GetContext(t *testing.T) {
+	g := NewGroup("ctx", 2<<10, RetrieverFuncCtx(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Actual: %v\tExpect: %v", err, context.DeadlineExceeded)
+	}
+}
+
+// 支持批量获取的回调 记录每次批量获取的key个数
+type batchDB struct {
+	batches []int
+}
+
+func (b *batchDB) Load(ctx context.Context, key string) ([]byte, error) {
+	if v, ok := db[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s not exist", key)
+}
+
+func (b *batchDB) LoadMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	b.batches = append(b.batches, len(keys))
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGroup_GetMulti(t *testing.T) {
+	loader := &batchDB{}
+	g := NewGroup("multi", 2<<10, loader)
+	g.Get("Tom")
+	results := g.GetMulti(context.Background(), []string{"Tom", "Jack", "Sam", "Lily", "Jack"})
+	if len(results) != 4 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(results), 4)
+	}
+	for key, want := range db {
+		if r := results[key]; r.Err != nil || r.Value.String() != want {
+			t.Fatalf("get %s failed: %v %s", key, r.Err, r.Value)
+		}
+	}
+	if results["Lily"].Err == nil {
+		t.Fatalf("Lily should not exist")
+	}
+	// Tom 命中缓存 其余三个key只触发一次批量获取
+	if len(loader.batches) != 1 || loader.batches[0] != 3 {
+		t.Fatalf("Actual: %v\tExpect: [3]", loader.batches)
+	}
+}
+
+// 批量获取时返回err 单个获取时与batchDB相同
+type errBatchDB struct {
+	batchDB
+	err error
+}
+
+func (b *errBatchDB) LoadMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.batchDB.LoadMulti(ctx, keys)
+}
+
+// 只有返回的map中没有的key写入墓碑 整个批量获取失败时不写入墓碑
+func TestGroup_GetMultiTombstones(t *testing.T) {
+	loader := &errBatchDB{err: fmt.Errorf("%w: table dropped", ErrNotFound)}
+	g := NewGroup("multi-tombstone", 2<<10, loader)
+	defer g.Close()
+
+	results := g.GetMulti(context.Background(), []string{"Tom", "Lily"})
+	if results["Tom"].Err == nil || results["Lily"].Err == nil {
+		t.Fatalf("failed batch should fail every key: %v", results)
+	}
+	if stats := g.CacheStats(NegativeCache); stats.Items != 0 {
+		t.Fatalf("failed batch should not write tombstones: %+v", stats)
+	}
+
+	loader.err = nil
+	results = g.GetMulti(context.Background(), []string{"Tom", "Lily"})
+	if results["Tom"].Value.String() != "630" || !errors.Is(results["Lily"].Err, ErrNotFound) {
+		t.Fatalf("GetMulti = %v", results)
+	}
+	if !g.tombstoned("Lily") || g.tombstoned("Tom") {
+		t.Fatalf("only Lily should be tombstoned")
+	}
+}
+
+// 单个获取时阻塞直到release关闭 批量获取时记录每次的key 并为Tom指定过期时长
+type gatedBatchDB struct {
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (b *gatedBatchDB) Load(ctx context.Context, key string) ([]byte, error) {
+	close(b.started)
+	<-b.release
+	return []byte(db[key]), nil
+}
+
+func (b *gatedBatchDB) LoadMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values, _, err := b.LoadMultiTTL(ctx, keys)
+	return values, err
+}
+
+func (b *gatedBatchDB) LoadMultiTTL(ctx context.Context, keys []string) (map[string][]byte, map[string]time.Duration, error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, keys)
+	b.mu.Unlock()
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		values[key] = []byte(db[key])
+	}
+	return values, map[string]time.Duration{"Tom": time.Minute}, nil
+}
+
+// 正在单个获取的key不会再被批量获取 批量获取时每个key使用各自的过期时长
+func TestGroup_GetMultiSingleflight(t *testing.T) {
+	loader := &gatedBatchDB{started: make(chan struct{}), release: make(chan struct{})}
+	g := NewGroup("multi-flight", 2<<10, loader, WithTTL(time.Hour))
+	defer g.Close()
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := g.Get("Jack")
+		got <- err
+	}()
+	<-loader.started
+	multi := make(chan map[string]Result, 1)
+	go func() {
+		multi <- g.GetMulti(context.Background(), []string{"Tom", "Jack"})
+	}()
+	waitFor(t, func() bool { return g.flight.Dups() > 0 })
+	close(loader.release)
+
+	results := <-multi
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+	if results["Tom"].Value.String() != "630" || results["Jack"].Value.String() != "589" {
+		t.Fatalf("GetMulti = %v", results)
+	}
+	if len(loader.batches) != 1 || len(loader.batches[0]) != 1 || loader.batches[0][0] != "Tom" {
+		t.Fatalf("Actual: %v\tExpect: [[Tom]]", loader.batches)
+	}
+	if v, ok := g.cache.get("Tom"); !ok || time.Until(v.e) > time.Minute {
+		t.Fatalf("Tom should use its own ttl: %v", v.e)
+	}
+}
+
+// 模拟远程节点 记录写入的值 down为true时所有请求失败
+// absent为true时不存在的key返回 ErrNotFound
+type fakePeer struct {
+	name   string
+	down   bool
+	absent bool
+	hang   bool // 写入时一直阻塞直到ctx结束
+	mu     sync.Mutex
+	data   map[string][]byte
+}
+
+func (p *fakePeer) Fetch(ctx context.Context, group string, key string) (ByteView, error) {
+	if v, ok := p.get(key); ok && !p.down {
+		return ByteView{b: v}, nil
+	}
+	if p.absent && !p.down {
+		return ByteView{}, notFound(key)
+	}
+	return ByteView{}, fmt.Errorf("peer %s unavailable", p.name)
+}
+
+func (p *fakePeer) BatchFetch(ctx context.Context, group string, keys []string) (map[string]Result, error) {
+	if p.down {
+		return nil, fmt.Errorf("peer %s unavailable", p.name)
+	}
+	results := make(map[string]Result, len(keys))
+	for _, key := range keys {
+		v, err := p.Fetch(ctx, group, key)
+		results[key] = Result{Value: v, Err: err}
+	}
+	return results, nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, group string, key string, value []byte) error {
+	if p.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if p.down {
+		return fmt.Errorf("peer %s unavailable", p.name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data[key] = value
+	return nil
+}
+
+func (p *fakePeer) Delete(ctx context.Context, group string, key string) error {
+	if p.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.data, key)
+	return nil
+}
+
+func (p *fakePeer) get(key string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.data[key]
+	return v, ok
+}
+
+// 所有key的副本都是固定的几个节点
+type fakePicker struct {
+	replicas []Fetcher
+}
+
+func (p *fakePicker) Pick(key string) (Fetcher, bool) {
+	if p.replicas[0] == nil {
+		return nil, false
+	}
+	return p.replicas[0], true
+}
+
+func (p *fakePicker) PickAll() []Fetcher { return nil }
+
+func (p *fakePicker) PickReplicas(key string, n int) []Fetcher {
+	if n > len(p.replicas) {
+		n = len(p.replicas)
+	}
+	return p.replicas[:n]
+}
+
+func TestGroup_Replication(t *testing.T) {
+	primary := &fakePeer{name: "primary", data: make(map[string][]byte)}
+	secondary := &fakePeer{name: "secondary", data: make(map[string][]byte)}
+	g := NewGroup("replication", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{primary, secondary, nil}})
+	g.SetReplication(3)
+
+	if err := g.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := primary.get("Tom"); string(v) != "630" {
+		t.Fatalf("Set should write to all replicas")
+	}
+	if v, _ := secondary.get("Tom"); string(v) != "630" {
+		t.Fatalf("Set should write to all replicas")
+	}
+	if v, ok := g.cache.get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("Set should write to local replica")
+	}
+	g.removeLocally("Tom")
+
+	// 主副本不可用时从下一个副本读取
+	primary.down = true
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get from secondary replica failed: %v %v", v, err)
+	}
+
+	if err := g.Delete("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := secondary.get("Tom"); ok {
+		t.Fatalf("Delete should remove from all replicas")
+	}
+}
+
+// 从源数据获取的值在后台写入其他副本
+func TestGroup_ReplicateLoaded(t *testing.T) {
+	secondary := &fakePeer{name: "secondary", data: make(map[string][]byte)}
+	g := NewGroup("replicate-loaded", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{nil, secondary}})
+	g.SetReplication(2)
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get Tom failed: %v %v", v, err)
+	}
+	waitFor(t, func() bool {
+		v, ok := secondary.get("Tom")
+		return ok && string(v) == "630"
+	})
+}
+
+// 一个副本无响应时 写入在ctx结束时返回 不会依次等待每个副本
+func TestGroup_SetContextParallel(t *testing.T) {
+	slow1 := &fakePeer{name: "slow1", hang: true, data: make(map[string][]byte)}
+	slow2 := &fakePeer{name: "slow2", hang: true, data: make(map[string][]byte)}
+	g := NewGroup("set-parallel", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{slow1, slow2, nil}})
+	g.SetReplication(3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := g.SetContext(ctx, "Tom", []byte("630")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SetContext err = %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > 180*time.Millisecond {
+		t.Fatalf("SetContext took %v, replicas should be written in parallel", d)
+	}
+	if v, ok := g.cache.get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("SetContext should still write to local replica")
+	}
+}
+
+// 默认不镜像远程节点的值 通过其他节点删除后 本节点不会返回旧值
+// 批量获取时主副本不可用 与 Get 一样从下一个副本获取 不回退到本地源
+func TestGroup_GetMultiReplicaFailover(t *testing.T) {
+	primary := &fakePeer{name: "primary", down: true, data: map[string][]byte{}}
+	secondary := &fakePeer{name: "secondary", absent: true, data: map[string][]byte{"Tom": []byte("630")}}
+	var loads atomic.Int32
+	g := NewGroup("multi-failover", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte(db[key]), nil
+	}))
+	defer g.Close()
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{primary, secondary}})
+	g.SetReplication(2)
+
+	results := g.GetMulti(context.Background(), []string{"Tom", "Lily"})
+	if r := results["Tom"]; r.Err != nil || r.Value.String() != "630" {
+		t.Fatalf("Tom = %v, want 630 from secondary", r)
+	}
+	if r := results["Lily"]; !errors.Is(r.Err, ErrNotFound) {
+		t.Fatalf("Lily = %v, want ErrNotFound from secondary", r)
+	}
+	if n := loads.Load(); n != 0 {
+		t.Fatalf("retriever called %d times, want 0", n)
+	}
+
+	// 所有副本都不可用时从本地源获取
+	secondary.down = true
+	if r := g.GetMulti(context.Background(), []string{"Jack"})["Jack"]; r.Err != nil || r.Value.String() != "589" || loads.Load() != 1 {
+		t.Fatalf("Jack = %v, want 589 from the retriever", r)
+	}
+}
+
+func TestGroup_HotCacheOptIn(t *testing.T) {
+	owner := &fakePeer{name: "owner", absent: true, data: map[string][]byte{"Tom": []byte("630")}}
+	b := NewGroup("hot-opt-in", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return nil, notFound(key)
+	}))
+	defer b.Close()
+	b.RegisterSvr(&fakePicker{replicas: []Fetcher{owner}})
+
+	for i := 0; i < 20; i++ {
+		if v, err := b.Get("Tom"); err != nil || v.String() != "630" {
+			t.Fatalf("Get Tom through b failed: %v %v", v, err)
+		}
+	}
+	// 通过所属节点删除
+	if err := owner.Delete(context.Background(), "hot-opt-in", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get("Tom"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get Tom through b after delete = %v, want ErrNotFound", err)
+	}
+	if stats := b.CacheStats(HotCache); stats.Items != 0 {
+		t.Errorf("hot cache should be off by default: %+v", stats)
+	}
+}
+
+func TestGroup_HotCache(t *testing.T) {
+	peer := &fakePeer{name: "owner", data: map[string][]byte{"Tom": []byte("630")}}
+	g := NewGroup("hot-cache", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{peer}})
+	// 每个从远程节点获取的值都放入热点缓存
+	g.SetHotCache(1<<10, 1)
+
+	for i := 0; i < 3; i++ {
+		if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+			t.Fatalf("Get Tom failed: %v %v", v, err)
+		}
+	}
+	// 远程节点不可用时仍能从热点缓存读取
+	peer.down = true
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get Tom from hot cache failed: %v %v", v, err)
+	}
+	if stats := g.CacheStats(HotCache); stats.Hits != 3 || stats.Items != 1 {
+		t.Errorf("hot cache stats = %+v, expect 3 hits and 1 item", stats)
+	}
+	if stats := g.CacheStats(MainCache); stats.Hits != 0 || stats.Items != 0 {
+		t.Errorf("main cache stats = %+v, expect empty", stats)
+	}
+
+	if err := g.Delete("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.hotCache.get("Tom"); ok {
+		t.Errorf("Delete should drop the hot copy")
+	}
+}
+
+func TestGroup_Stats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("unknown")
+	stats := g.Stats()
+	expect := Stats{Gets: 3, LocalHits: 1, Misses: 2, RetrieverLoads: 2, RetrieverErrors: 1, Items: 1, Bytes: int64(len("Tom") + len("630"))}
+	if stats != expect {
+		t.Fatalf("Actual: %+v\tExpect: %+v", stats, expect)
+	}
+}
+
+func TestGroup_Close(t *testing.T) {
+	g := NewGroup("close", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.RegisterSvr(&fakePicker{replicas: []Fetcher{nil}})
+	// 不是 server 的 Picker 不会导致panic
+	DestoryGroup("close")
+	if GetGroup("close") != nil {
+		t.Fatalf("group should be removed")
+	}
+	g.Close()
+}
+
+func TestGroup_NegativeCache(t *testing.T) {
+	loads := 0
+	g := NewGroup("negative", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		if key == "broken" {
+			return nil, errors.New("connection refused")
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}), WithNegativeCache(50*time.Millisecond, 1<<10))
+	defer g.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("Lily"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get Lily: %v, want ErrNotFound", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("missing key should be retrieved once, got %d", loads)
+	}
+	if stats := g.Stats(); stats.NegativeHits != 2 {
+		t.Errorf("negative hits = %d, want 2", stats.NegativeHits)
+	}
+	if stats := g.CacheStats(NegativeCache); stats.Items != 1 || stats.Bytes != int64(len("Lily")) {
+		t.Errorf("negative cache stats = %+v", stats)
+	}
+
+	// 其他错误不缓存
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get("broken"); !errors.Is(err, ErrRetrieverFailed) {
+			t.Fatalf("get broken: %v, want ErrRetrieverFailed", err)
+		}
+	}
+	if loads != 3 {
+		t.Fatalf("retriever errors should not be cached, loads = %d", loads)
+	}
+
+	// 写入后墓碑失效
+	if err := g.Set("Lily", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("Lily"); err != nil || v.String() != "1" {
+		t.Fatalf("get Lily after set: %v %s", err, v)
+	}
+
+	// 墓碑过期后重新获取
+	g.Get("Bob")
+	time.Sleep(60 * time.Millisecond)
+	g.Get("Bob")
+	if loads != 5 {
+		t.Fatalf("expired tombstone should be retrieved again, loads = %d", loads)
+	}
+
+	// 远程节点返回 ErrNotFound 时不回退到本地获取 并在本地记录墓碑
+	owner := &fakePeer{name: "owner", absent: true, data: make(map[string][]byte)}
+	peerLoads := 0
+	pg := NewGroup("negative-peer", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		peerLoads++
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}))
+	defer pg.Close()
+	pg.RegisterSvr(&fakePicker{replicas: []Fetcher{owner}})
+	for i := 0; i < 2; i++ {
+		if _, err := pg.Get("Lily"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("get Lily from peer: %v, want ErrNotFound", err)
+		}
+	}
+	if stats := pg.Stats(); peerLoads != 0 || stats.PeerErrors != 0 || stats.NegativeHits != 1 {
+		t.Errorf("peer not found: retriever loads %d, stats %+v", peerLoads, stats)
+	}
+}
+
+// 主缓存较小时 热点缓存和墓碑缓存不会变成不限制内存
+func TestGroup_DerivedCacheBytes(t *testing.T) {
+	loader := RetrieverFunc(func(key string) ([]byte, error) { return nil, notFound(key) })
+	g := NewGroup("derived-small", 8, loader)
+	defer g.Close()
+	if g.hotCache.capacity != 1 || g.negCache.capacity != 1 {
+		t.Fatalf("hot %d negative %d, want 1", g.hotCache.capacity, g.negCache.capacity)
+	}
+	g.Get("Lily")
+	g.Get("Bob")
+	if stats := g.CacheStats(NegativeCache); stats.Items != 1 {
+		t.Fatalf("negative cache should keep only the latest tombstone: %+v", stats)
+	}
+	u := NewGroup("derived-unlimited", 0, loader)
+	defer u.Close()
+	if u.hotCache.capacity != 0 || u.negCache.capacity != 0 {
+		t.Fatalf("hot %d negative %d, want unlimited", u.hotCache.capacity, u.negCache.capacity)
+	}
+}
+
+// 等待cond成立 超时后失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGroup_StaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	g := NewGroup("swr", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		n := loads.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return []byte(fmt.Sprint(n)), nil
+	}), WithTTL(time.Hour), WithSoftTTL(20*time.Millisecond))
+	defer g.Close()
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "1" || v.Stale() {
+		t.Fatalf("first get: %v %s", err, v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 变旧后立即返回旧值 刷新阻塞期间只有一个后台刷新
+	for i := 0; i < 5; i++ {
+		if v, err := g.Get("Tom"); err != nil || v.String() != "1" || !v.Stale() {
+			t.Fatalf("stale get: %v %s", err, v)
+		}
+	}
+	close(release)
+	waitFor(t, func() bool {
+		v, _ := g.Get("Tom")
+		return v.String() == "2"
+	})
+	if n := loads.Load(); n != 2 {
+		t.Errorf("loads = %d, want 2", n)
+	}
+	if stats := g.Stats(); stats.Refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", stats.Refreshes)
+	}
+}
+
+func TestGroup_CloseCancelsRefresh(t *testing.T) {
+	var loads atomic.Int32
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	g := NewGroup("close-refresh", 2<<10, RetrieverFuncCtx(func(ctx context.Context, key string) ([]byte, error) {
+		if loads.Add(1) == 1 {
+			return []byte("v1"), nil
+		}
+		// 后台刷新一直阻塞到ctx被取消
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}), WithTTL(50*time.Millisecond), WithRefreshAhead(40*time.Millisecond))
+
+	g.Get("Tom")
+	time.Sleep(20 * time.Millisecond)
+	// 进入提前刷新的窗口 命中时启动后台刷新
+	g.Get("Tom")
+	<-started
+	done := make(chan struct{})
+	go func() {
+		g.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("close should cancel the refresh")
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Fatalf("refresh should be canceled before close returns")
+	}
+	// 关闭后命中不再启动后台刷新
+	g.Get("Tom")
+	time.Sleep(20 * time.Millisecond)
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("loads = %d, want 2", n)
+	}
+}
+
+func TestGroup_RefreshAhead(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroup("refresh-ahead", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(fmt.Sprint(loads.Add(1))), nil
+	}), WithTTL(100*time.Millisecond), WithRefreshAhead(80*time.Millisecond))
+	defer g.Close()
+
+	first, _ := g.Get("Tom")
+	// 还没有进入提前刷新的窗口
+	g.Get("Tom")
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 进入窗口后命中 返回当前值并在后台刷新 刷新后的值有新的过期时间
+	if v, err := g.Get("Tom"); err != nil || v.String() != "1" {
+		t.Fatalf("get in refresh window: %v %s", err, v)
+	}
+	waitFor(t, func() bool {
+		v, _ := g.Get("Tom")
+		return v.String() != "1" && v.Expire().After(first.Expire())
+	})
+}
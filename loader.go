@@ -0,0 +1,131 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 调用 Loader 获取源数据 若实现了 TTLLoader 则同时返回过期时长
+func loadTTL(ctx context.Context, l Loader, key string) ([]byte, time.Duration, error) {
+	if tl, ok := l.(TTLLoader); ok {
+		return tl.LoadTTL(ctx, key)
+	}
+	bytes, err := l.Load(ctx, key)
+	return bytes, 0, err
+}
+
+// 调用 BatchLoader 批量获取源数据 若实现了 BatchTTLLoader 则同时返回每个key的过期时长
+func loadMultiTTL(ctx context.Context, bl BatchLoader, keys []string) (map[string][]byte, map[string]time.Duration, error) {
+	if tl, ok := bl.(BatchTTLLoader); ok {
+		return tl.LoadMultiTTL(ctx, keys)
+	}
+	values, err := bl.LoadMulti(ctx, keys)
+	return values, nil, err
+}
+
+// 按顺序尝试多个 Loader 直到有一个成功
+type fallbackLoader struct {
+	loaders []Loader
+}
+
+// FallbackLoader 返回一个按顺序尝试 loaders 的 Loader
+// 前一个 Loader 失败时尝试下一个 全部失败时返回最后一个错误
+func FallbackLoader(loaders ...Loader) Loader {
+	return &fallbackLoader{loaders: loaders}
+}
+
+func (f *fallbackLoader) Load(ctx context.Context, key string) ([]byte, error) {
+	bytes, _, err := f.LoadTTL(ctx, key)
+	return bytes, err
+}
+
+func (f *fallbackLoader) LoadTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	err := fmt.Errorf("%w: no loader for key %s", ErrNotFound, key)
+	for _, l := range f.loaders {
+		var bytes []byte
+		var ttl time.Duration
+		if bytes, ttl, err = loadTTL(ctx, l, key); err == nil {
+			return bytes, ttl, nil
+		}
+		// 调用者已经超时或取消 不再尝试后面的 Loader
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+	}
+	return nil, 0, err
+}
+
+// 为每次加载设置超时时间
+type timeoutLoader struct {
+	loader  Loader
+	timeout time.Duration
+}
+
+// TimeoutLoader 返回一个每次加载最多执行 timeout 的 Loader
+// 超时后 ctx 被取消 l 需要自行感知ctx并返回
+func TimeoutLoader(l Loader, timeout time.Duration) Loader {
+	return &timeoutLoader{loader: l, timeout: timeout}
+}
+
+func (t *timeoutLoader) Load(ctx context.Context, key string) ([]byte, error) {
+	bytes, _, err := t.LoadTTL(ctx, key)
+	return bytes, err
+}
+
+func (t *timeoutLoader) LoadTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return loadTTL(ctx, t.loader, key)
+}
+
+// 加载失败时按指数退避重试
+type retryLoader struct {
+	loader   Loader
+	attempts int
+	backoff  time.Duration
+}
+
+// RetryLoader 返回一个失败后重试的 Loader 最多调用 l attempts 次
+// 第一次重试前等待 backoff 之后每次等待时间翻倍 返回 ErrNotFound 时不重试
+func RetryLoader(l Loader, attempts int, backoff time.Duration) Loader {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &retryLoader{loader: l, attempts: attempts, backoff: backoff}
+}
+
+func (r *retryLoader) Load(ctx context.Context, key string) ([]byte, error) {
+	bytes, _, err := r.LoadTTL(ctx, key)
+	return bytes, err
+}
+
+func (r *retryLoader) LoadTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	backoff := r.backoff
+	var err error
+	for i := 0; i < r.attempts; i++ {
+		var bytes []byte
+		var ttl time.Duration
+		if bytes, ttl, err = loadTTL(ctx, r.loader, key); err == nil {
+			return bytes, ttl, nil
+		}
+		// key不存在不是暂时的错误 立即返回以便写入墓碑 最后一次失败后不再等待
+		if errors.Is(err, ErrNotFound) || i == r.attempts-1 {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		backoff *= 2
+	}
+	return nil, 0, err
+}
+
+var (
+	_ TTLLoader = (*fallbackLoader)(nil)
+	_ TTLLoader = (*timeoutLoader)(nil)
+	_ TTLLoader = (*retryLoader)(nil)
+)
@@ -0,0 +1,56 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFallbackLoader(t *testing.T) {
+	failed := RetrieverFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("primary down")
+	})
+	backup := RetrieverTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		return []byte(db[key]), time.Minute, nil
+	})
+	bytes, ttl, err := loadTTL(context.Background(), FallbackLoader(failed, backup), "Tom")
+	if err != nil || string(bytes) != "630" || ttl != time.Minute {
+		t.Fatalf("fallback load failed: %v %s %v", err, bytes, ttl)
+	}
+}
+
+func TestRetryLoader(t *testing.T) {
+	calls := 0
+	flaky := RetrieverFunc(func(key string) ([]byte, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("flaky")
+		}
+		return []byte(db[key]), nil
+	})
+	bytes, err := RetryLoader(flaky, 3, time.Millisecond).Load(context.Background(), "Jack")
+	if err != nil || string(bytes) != "589" || calls != 3 {
+		t.Fatalf("retry load failed: %v %s %d", err, bytes, calls)
+	}
+	// key不存在时不重试
+	calls = 0
+	missing := RetrieverFunc(func(key string) ([]byte, error) {
+		calls++
+		return nil, notFound(key)
+	})
+	if _, err := RetryLoader(missing, 3, time.Second).Load(context.Background(), "Lily"); !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Fatalf("not found should not be retried: %v, %d calls", err, calls)
+	}
+}
+
+func TestTimeoutLoader(t *testing.T) {
+	slow := RetrieverFuncCtx(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	_, err := TimeoutLoader(slow, time.Millisecond).Load(context.Background(), "Sam")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Actual: %v\tExpect: %v", err, context.DeadlineExceeded)
+	}
+}
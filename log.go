@@ -0,0 +1,41 @@
+package gocache
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/neijuanxiaozi/gocache/logger"
+)
+
+// Logger 是 gocache 使用的分级结构化日志接口 *slog.Logger 直接实现了该接口
+type Logger = logger.Logger
+
+// 新建的 Group 和 server 默认使用的 Logger
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	SetLogger(nil)
+}
+
+// SetLogger 设置之后新建的 Group 和 server 默认使用的 Logger l为nil时不输出日志
+// 已经创建的实例可以通过各自的 SetLogger 修改
+func SetLogger(l Logger) {
+	if l == nil {
+		l = logger.Nop()
+	}
+	defaultLogger.Store(&l)
+}
+
+// NewSlogLogger 返回使用 l 输出日志的 Logger l为nil时使用 slog.Default()
+func NewSlogLogger(l *slog.Logger) Logger {
+	return logger.Slog(l)
+}
+
+func currentLogger() Logger {
+	return *defaultLogger.Load()
+}
+
+// 判断是否输出debug日志 避免在热路径上计算日志字段
+func debugEnabled(l Logger) bool {
+	return logger.Enabled(l, slog.LevelDebug)
+}
@@ -0,0 +1,63 @@
+// Package logger 定义 gocache 使用的分级结构化日志接口
+// 日志的附加字段以 slog 风格的键值对传入 如 logger.Info("peers changed", "added", added)
+package logger
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+)
+
+// Logger 分级结构化日志接口 *slog.Logger 直接实现了该接口
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// 不输出任何日志 默认使用
+type nop struct{}
+
+func (nop) Debug(string, ...any) {}
+func (nop) Info(string, ...any)  {}
+func (nop) Warn(string, ...any)  {}
+func (nop) Error(string, ...any) {}
+
+// Nop 返回不输出任何日志的 Logger
+func Nop() Logger {
+	return nop{}
+}
+
+// Slog 返回使用 l 输出日志的 Logger l为nil时使用 slog.Default()
+func Slog(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
+
+// SlogHandler 返回使用 h 输出日志的 Logger
+func SlogHandler(h slog.Handler) Logger {
+	return slog.New(h)
+}
+
+// Enabled 判断 l 是否会输出 level 级别的日志 用于在构造开销较大的字段之前判断
+// 只有基于 slog 的 Logger 能够判断 其他实现总是返回true
+func Enabled(l Logger, level slog.Level) bool {
+	switch l := l.(type) {
+	case nop:
+		return false
+	case *slog.Logger:
+		return l.Enabled(context.Background(), level)
+	}
+	return true
+}
+
+// KeyHash 返回key的哈希值 日志中用它代替key 避免输出可能包含敏感信息的原始key
+func KeyHash(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := SlogHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if Enabled(l, slog.LevelDebug) || !Enabled(l, slog.LevelInfo) {
+		t.Fatalf("Enabled should follow the handler level")
+	}
+	l.Debug("hidden")
+	l.Info("peers changed", "peer", "127.0.0.1:6324")
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "peer=127.0.0.1:6324") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+	if Enabled(Nop(), slog.LevelError) {
+		t.Fatalf("Nop should never be enabled")
+	}
+}
+
+func TestKeyHash(t *testing.T) {
+	if KeyHash("Tom") != KeyHash("Tom") || KeyHash("Tom") == KeyHash("Jack") {
+		t.Fatalf("KeyHash should be stable and distinguish keys")
+	}
+}
@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 // 接口类型 实现了获取长度的函数
 type Lengthable interface {
@@ -9,11 +12,26 @@ type Lengthable interface {
 
 // 双向链表节点的数据类型
 type Value struct {
-	key   string
-	value Lengthable //接口类型 实现了获取长度的函数
+	key    string
+	value  Lengthable //接口类型 实现了获取长度的函数
+	expire time.Time  // 过期时间 零值表示永不过期
 }
+
+// 判断节点在now时刻是否已经过期
+func (v *Value) expired(now time.Time) bool {
+	return !v.expire.IsZero() && now.After(v.expire)
+}
+
 type OnEliminated func(key string, Value Lengthable)
 
+// Policy 是容量不足时选择被淘汰节点的策略
+type Policy int
+
+const (
+	LRU  Policy = iota // 淘汰最久未被访问的节点
+	FIFO               // 淘汰最早写入的节点 访问和更新不改变节点的顺序
+)
+
 // lru
 type Cache struct {
 	capacity         int64                    // 最大内存
@@ -21,53 +39,81 @@ type Cache struct {
 	doublyLinkedList *list.List               // 双链表
 	hashmap          map[string]*list.Element // map key是string 值是链表中值对应的指针
 	callback         OnEliminated             // 当一个entry被清除时执行的函数
+	evictions        int64                    // 因容量不足被淘汰的节点个数
+	policy           Policy                   // 淘汰策略
 }
 
 // 实例化cache
 func New(maxBytes int64, callback OnEliminated) *Cache {
+	return NewWithPolicy(maxBytes, LRU, callback)
+}
+
+// NewWithPolicy 实例化使用指定淘汰策略的cache
+func NewWithPolicy(maxBytes int64, policy Policy, callback OnEliminated) *Cache {
 	return &Cache{
 		capacity:         maxBytes,
 		doublyLinkedList: list.New(),
 		hashmap:          make(map[string]*list.Element),
 		callback:         callback,
+		policy:           policy,
+	}
+}
+
+// 节点被访问或更新 LRU策略下移到链表头
+func (c *Cache) touch(elem *list.Element) {
+	if c.policy == LRU {
+		c.doublyLinkedList.MoveToFront(elem)
 	}
 }
 
-// 获取节点value 并移动到链表头部
+// 获取节点value 并移动到链表头部 已过期的节点会被惰性删除
 func (c *Cache) Get(key string) (value Lengthable, ok bool) {
 	// 如果缓存中存在key
 	if elem, ok := c.hashmap[key]; ok {
-		// 将元素移到链表头
-		c.doublyLinkedList.MoveToFront(elem)
 		// 将元素断言成Value类型
 		entry := elem.Value.(*Value)
+		// 已过期 删除并当作未命中
+		if entry.expired(time.Now()) {
+			c.removeElement(elem)
+			return nil, false
+		}
+		// LRU策略下将元素移到链表头
+		c.touch(elem)
 		// 返回元素中实际包含的值
 		return entry.value, true
 	}
 	return
 }
 
-//	向缓存中添加值
+// 向缓存中添加值 永不过期
 func (c *Cache) Add(key string, value Lengthable) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// 向缓存中添加值 并设置过期时间 expire为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value Lengthable, expire time.Time) {
 	// 算出新添加的kv的大小
 	kvSize := int64(len(key)) + int64(value.Len())
 	// 当lru容量不够时 持续从链表尾pop元素 直到能够放下新元素
-	for c.capacity != 0 && kvSize+c.length > c.capacity {
+	// 链表为空时停止 避免单个kv大于容量时死循环
+	for c.capacity != 0 && kvSize+c.length > c.capacity && c.doublyLinkedList.Len() > 0 {
 		c.Remove()
+		c.evictions++
 	}
 	// 如果该元素已经存在
 	if elem, ok := c.hashmap[key]; ok {
-		// 重新放到链表头
-		c.doublyLinkedList.MoveToFront(elem)
+		// LRU策略下重新放到链表头
+		c.touch(elem)
 		// 拿到旧元素  断言成指针 方便后续修改
 		oldEntry := elem.Value.(*Value)
 		// 更改缓存当前大小
-		c.length += int64(oldEntry.value.Len()) - int64(value.Len())
-		// 更改key对应的元素值
+		c.length += int64(value.Len()) - int64(oldEntry.value.Len())
+		// 更改key对应的元素值和过期时间
 		oldEntry.value = value
+		oldEntry.expire = expire
 	} else {
 		// 用key和value生成新的元素插入链表头
-		elem := c.doublyLinkedList.PushFront(&Value{key: key, value: value})
+		elem := c.doublyLinkedList.PushFront(&Value{key: key, value: value, expire: expire})
 		// 更新缓存的哈希表
 		c.hashmap[key] = elem
 		// 更新缓存大小
@@ -79,13 +125,58 @@ func (c *Cache) Add(key string, value Lengthable) {
 func (c *Cache) Remove() {
 	tailElem := c.doublyLinkedList.Back()
 	if tailElem != nil {
-		entry := tailElem.Value.(*Value)
-		k, v := entry.key, entry.value
-		delete(c.hashmap, k)
-		c.doublyLinkedList.Remove(tailElem)
-		c.length -= int64(len(k)) + int64(v.Len())
-		if c.callback != nil {
-			c.callback(k, v)
+		c.removeElement(tailElem)
+	}
+}
+
+// RemoveExpired 删除所有已过期的节点 返回删除的个数
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for elem := c.doublyLinkedList.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*Value).expired(now) {
+			c.removeElement(elem)
+			removed++
 		}
+		elem = prev
+	}
+	return removed
+}
+
+// Delete 删除指定key 返回key是否存在
+func (c *Cache) Delete(key string) bool {
+	elem, ok := c.hashmap[key]
+	if !ok {
+		return false
+	}
+	c.removeElement(elem)
+	return true
+}
+
+// Len 返回缓存中的节点个数
+func (c *Cache) Len() int {
+	return c.doublyLinkedList.Len()
+}
+
+// Bytes 返回缓存当前使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.length
+}
+
+// Evictions 返回因容量不足被淘汰的节点个数
+func (c *Cache) Evictions() int64 {
+	return c.evictions
+}
+
+// 从链表和哈希表中删除元素 并执行回调
+func (c *Cache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*Value)
+	k, v := entry.key, entry.value
+	delete(c.hashmap, k)
+	c.doublyLinkedList.Remove(elem)
+	c.length -= int64(len(k)) + int64(v.Len())
+	if c.callback != nil {
+		c.callback(k, v)
 	}
 }
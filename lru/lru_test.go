@@ -1,6 +1,9 @@
 package lru
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 type String string
 
@@ -18,3 +21,69 @@ func TestGet(t *testing.T) {
 		t.Fatalf("cache miss key2 failed")
 	}
 }
+
+func TestDelete(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	if !lru.Delete("key1") {
+		t.Fatalf("delete key1 failed")
+	}
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("key1 should be deleted")
+	}
+	if lru.length != 0 {
+		t.Fatalf("Actual: %d\tExpect: %d", lru.length, 0)
+	}
+	if lru.Delete("key2") {
+		t.Fatalf("delete missing key2 should return false")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	lru.AddWithExpire("key3", String("90"), time.Now().Add(-time.Second))
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("key1 should be expired")
+	}
+	if v, ok := lru.Get("key2"); !ok || string(v.(String)) != "5678" {
+		t.Fatalf("cache hit key2=5678 failed")
+	}
+	if n := lru.RemoveExpired(); n != 1 {
+		t.Fatalf("Actual: %d\tExpect: %d", n, 1)
+	}
+	if len(lru.hashmap) != 1 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(lru.hashmap), 1)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	lru := New(int64(10), nil)
+	lru.Add("k1", String("1234"))
+	lru.Add("k2", String("5678"))
+	lru.Add("k3", String("90"))
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 2 || lru.Evictions() != 1 {
+		t.Fatalf("k1 should be evicted, len=%d evictions=%d", lru.Len(), lru.Evictions())
+	}
+	// 大于容量的kv 淘汰所有节点后仍然写入
+	lru.Add("big", String("12345678901"))
+	if lru.Len() != 1 || lru.Bytes() != 14 {
+		t.Fatalf("Actual: len=%d bytes=%d\tExpect: len=1 bytes=14", lru.Len(), lru.Bytes())
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	lru := NewWithPolicy(int64(12), FIFO, nil)
+	lru.Add("k1", String("1234"))
+	lru.Add("k2", String("5678"))
+	// FIFO 访问不改变顺序 仍然淘汰最早写入的k1
+	lru.Get("k1")
+	lru.Add("k3", String("90"))
+	if _, ok := lru.Get("k1"); ok {
+		t.Fatalf("k1 should be evicted first")
+	}
+	if _, ok := lru.Get("k2"); !ok {
+		t.Fatalf("k2 should still be cached")
+	}
+}
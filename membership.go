@@ -0,0 +1,135 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/registry"
+	"github.com/neijuanxiaozi/gocache/utils"
+)
+
+const (
+	defaultMembershipDebounce = 500 * time.Millisecond // 节点变化的防抖时间 这段时间内的多次变化合并为一次hash环更新
+	minWatchRetryBackoff      = 100 * time.Millisecond // 重新监听注册中心前的最短等待时间
+	maxWatchRetryBackoff      = 10 * time.Second       // 重新监听注册中心前的最长等待时间
+)
+
+// 注册中心关闭了监听的管道
+var errWatchClosed = errors.New("watch channel closed")
+
+// MembershipFunc 节点变化时的回调 参数为新加入和离开的节点地址
+type MembershipFunc func(added, removed []string)
+
+// OnMembershipChange 设置节点变化时的回调 可用于记录日志和统计hash环的变动
+// 回调在更新hash环之后调用 不持有server的锁
+func (s *server) OnMembershipChange(fn MembershipFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onMembership = fn
+}
+
+// 监听注册中心中 gocache/ 前缀下的节点变化 防抖后更新hash环和客户端
+// 监听失败或管道被关闭(如etcd压缩 租约或连接出错)时 按指数退避重新监听 直到ctx结束
+func (s *server) watchPeers(ctx context.Context, reg registry.Registry) {
+	backoff := minWatchRetryBackoff
+	for {
+		received, err := s.watchOnce(ctx, reg)
+		if ctx.Err() != nil {
+			return
+		}
+		// 上次监听收到过节点列表 说明注册中心恢复过 从最短的等待时间开始
+		if received {
+			backoff = minWatchRetryBackoff
+		}
+		s.logger.Warn("watch peers stopped, retrying", "addr", s.addr, "error", err, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxWatchRetryBackoff)
+	}
+}
+
+// 监听一次节点变化 直到管道被关闭或ctx结束 received表示是否收到过节点列表
+func (s *server) watchOnce(ctx context.Context, reg registry.Registry) (received bool, err error) {
+	ch, err := reg.Watch(ctx, s.serviceName)
+	if err != nil {
+		return false, err
+	}
+	var pending []registry.Endpoint
+	var debounce <-chan time.Time
+	for {
+		select {
+		case eps, ok := <-ch:
+			if !ok {
+				// 管道关闭前收到的变化仍然生效
+				if debounce != nil {
+					s.updatePeers(pending)
+				}
+				return received, errWatchClosed
+			}
+			received = true
+			pending = eps
+			// 第一次变化时开始计时 计时结束前的变化只保留最新的节点列表
+			if debounce == nil {
+				debounce = time.After(s.membershipDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			s.updatePeers(pending)
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+}
+
+// 用注册中心给出的节点列表更新hash环 节点和权重都没有变化时不做任何操作
+func (s *server) updatePeers(eps []registry.Endpoint) {
+	s.mu.Lock()
+	if !s.status {
+		s.mu.Unlock()
+		return
+	}
+	// 自己总是在hash环上 即使注册中心暂时没有自己的记录
+	peers := map[string]int{s.addr: s.weight}
+	for _, ep := range eps {
+		if !utils.ValidPeerAddr(ep.Addr) {
+			s.logger.Warn("ignore invalid peer address", "addr", s.addr, "peer", ep.Addr)
+			continue
+		}
+		peers[ep.Addr] = ep.Weight()
+	}
+
+	var added, removed []string
+	reweighted := false
+	for peerAddr, weight := range peers {
+		if _, ok := s.clients[peerAddr]; !ok {
+			added = append(added, peerAddr)
+		} else if s.consHash.Weight(peerAddr) != weight {
+			reweighted = true
+		}
+	}
+	for peerAddr := range s.clients {
+		if _, ok := peers[peerAddr]; !ok {
+			removed = append(removed, peerAddr)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 && !reweighted {
+		s.mu.Unlock()
+		return
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	s.setPeers(peers)
+	fn := s.onMembership
+	logger := s.logger
+	s.mu.Unlock()
+
+	logger.Info("peers changed", "addr", s.addr, "added", added, "removed", removed)
+	if fn != nil {
+		fn(added, removed)
+	}
+}
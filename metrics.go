@@ -0,0 +1,212 @@
+package gocache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 以Prometheus文本格式导出的指标前缀
+const metricsNamespace = "gocache"
+
+// SetMetricsAddr 设置导出Prometheus指标的http监听地址 如":9100" 需要在Start之前调用
+// 为空时不启动http服务 也可以通过 MetricsHandler 挂载到已有的http服务上
+func (s *server) SetMetricsAddr(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metricsAddr = addr
+}
+
+// 启动http服务导出指标 需要持有s.mu
+func (s *server) startMetrics() error {
+	if s.metricsAddr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", s.metricsAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+	s.metricsSrv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go s.metricsSrv.Serve(lis)
+	return nil
+}
+
+// 关闭导出指标的http服务 需要持有s.mu
+func (s *server) stopMetrics() {
+	if s.metricsSrv == nil {
+		return
+	}
+	s.metricsSrv.Close()
+	s.metricsSrv = nil
+}
+
+// MetricsHandler 返回以Prometheus文本格式导出所有 Group 和远程节点指标的 http.Handler
+func (s *server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.writeMetrics(w)
+	})
+}
+
+// 指标中的一个 Group
+type groupMetrics struct {
+	name    string
+	stats   Stats
+	main    CacheStats
+	hot     CacheStats
+	neg     CacheStats
+	latency Histogram
+}
+
+// 返回所有 Group 的统计信息 按名称排序
+func collectGroups() []groupMetrics {
+	mu.RLock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	mu.RUnlock()
+	metrics := make([]groupMetrics, 0, len(all))
+	for _, g := range all {
+		metrics = append(metrics, groupMetrics{
+			name:    g.name,
+			stats:   g.Stats(),
+			main:    g.CacheStats(MainCache),
+			hot:     g.CacheStats(HotCache),
+			neg:     g.CacheStats(NegativeCache),
+			latency: g.LoadLatency(),
+		})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	return metrics
+}
+
+func (s *server) writeMetrics(out io.Writer) {
+	w := &metricsWriter{w: bufio.NewWriter(out)}
+	defer w.w.Flush()
+
+	all := collectGroups()
+	counter := func(name, help string, value func(m groupMetrics) int64) {
+		w.family(name, "counter", help)
+		for _, m := range all {
+			w.sample(name, float64(value(m)), "group", m.name)
+		}
+	}
+	counter("gets_total", "Get requests received by the group.", func(m groupMetrics) int64 { return m.stats.Gets })
+	counter("misses_total", "Get requests that missed the main, hot and negative cache.", func(m groupMetrics) int64 { return m.stats.Misses })
+	counter("peer_loads_total", "Values loaded from remote peers.", func(m groupMetrics) int64 { return m.stats.PeerLoads })
+	counter("peer_errors_total", "Failed loads from remote peers.", func(m groupMetrics) int64 { return m.stats.PeerErrors })
+	counter("retriever_loads_total", "Calls to the group's retriever.", func(m groupMetrics) int64 { return m.stats.RetrieverLoads })
+	counter("retriever_errors_total", "Retriever calls that returned an error.", func(m groupMetrics) int64 { return m.stats.RetrieverErrors })
+	counter("refreshes_total", "Background refreshes of stale or soon-to-expire values.", func(m groupMetrics) int64 { return m.stats.Refreshes })
+	counter("singleflight_dedups_total", "Loads deduplicated by singleflight.", func(m groupMetrics) int64 { return m.stats.Dedups })
+
+	w.family("singleflight_in_flight", "gauge", "Loads currently in flight.")
+	for _, m := range all {
+		w.sample("singleflight_in_flight", float64(m.stats.InFlight), "group", m.name)
+	}
+
+	perCache := func(name, typ, help string, value func(c CacheStats) int64) {
+		w.family(name, typ, help)
+		for _, m := range all {
+			w.sample(name, float64(value(m.main)), "group", m.name, "cache", "main")
+			w.sample(name, float64(value(m.hot)), "group", m.name, "cache", "hot")
+			w.sample(name, float64(value(m.neg)), "group", m.name, "cache", "negative")
+		}
+	}
+	perCache("hits_total", "counter", "Cache hits.", func(c CacheStats) int64 { return c.Hits })
+	perCache("evictions_total", "counter", "Entries evicted because the cache was full.", func(c CacheStats) int64 { return c.Evictions })
+	perCache("cache_bytes", "gauge", "Bytes held by the cache.", func(c CacheStats) int64 { return c.Bytes })
+	perCache("cache_items", "gauge", "Entries held by the cache.", func(c CacheStats) int64 { return c.Items })
+
+	w.family("load_duration_seconds", "histogram", "Time spent loading values on cache misses.")
+	for _, m := range all {
+		w.histogram("load_duration_seconds", m.latency, "group", m.name)
+	}
+
+	s.mu.Lock()
+	ringPeers := 0
+	if s.consHash != nil {
+		ringPeers = len(s.consHash.Peers())
+	}
+	s.mu.Unlock()
+	w.family("ring_peers", "gauge", "Peers in the placement ring, including this node.")
+	w.sample("ring_peers", float64(ringPeers))
+
+	peerStats := s.PeerStats()
+	w.family("peer_rpc_duration_seconds", "histogram", "Latency of RPCs to remote peers by method and status code.")
+	for _, peer := range peerStats {
+		for _, method := range sortedKeys(peer.Methods) {
+			codes := peer.Methods[method].Codes
+			for _, code := range sortedKeys(codes) {
+				w.histogram("peer_rpc_duration_seconds", codes[code], "peer", peer.Addr, "method", method, "code", code)
+			}
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 按Prometheus文本格式写入指标
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// 写入指标族的 HELP 和 TYPE
+func (w *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s_%s %s\n", metricsNamespace, name, help)
+	fmt.Fprintf(w.w, "# TYPE %s_%s %s\n", metricsNamespace, name, typ)
+}
+
+// 写入一个样本 labels 是成对的标签名和标签值
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	fmt.Fprintf(w.w, "%s_%s%s %s\n", metricsNamespace, name, formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// 写入直方图的累计桶 _sum 和 _count 耗时以秒为单位
+func (w *metricsWriter) histogram(name string, h Histogram, labels ...string) {
+	// 限制容量 使append总是分配新的切片 不修改调用者的labels
+	labels = labels[:len(labels):len(labels)]
+	var cumulative int64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		w.sample(name+"_bucket", float64(cumulative), append(labels, "le", le)...)
+	}
+	w.sample(name+"_bucket", float64(h.Count), append(labels, "le", "+Inf")...)
+	w.sample(name+"_sum", h.Sum.Seconds(), labels...)
+	w.sample(name+"_count", float64(h.Count), labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package gocache
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neijuanxiaozi/gocache/registry"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	svr, err := NewServerWithRegistry("127.0.0.1:16327", registry.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers("127.0.0.1:16327", "127.0.0.1:16328")
+	g := NewGroup("metrics", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.Get("Tom")
+	g.Get("Tom")
+
+	rec := httptest.NewRecorder()
+	svr.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, line := range []string{
+		"# TYPE gocache_gets_total counter",
+		`gocache_gets_total{group="metrics"} 2`,
+		`gocache_misses_total{group="metrics"} 1`,
+		`gocache_hits_total{group="metrics",cache="main"} 1`,
+		`gocache_cache_items{group="metrics",cache="main"} 1`,
+		`gocache_load_duration_seconds_bucket{group="metrics",le="+Inf"} 1`,
+		`gocache_load_duration_seconds_count{group="metrics"} 1`,
+		"gocache_ring_peers 2",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics should contain %q", line)
+		}
+	}
+}
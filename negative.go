@@ -0,0 +1,45 @@
+package gocache
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultNegativeTTL        = 5 * time.Second // 墓碑默认的过期时长
+	defaultNegativeCacheRatio = 16              // 墓碑缓存默认占用主缓存1/16的内存
+)
+
+// 返回key不存在的错误
+func notFound(key string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+// 为不存在的key写入墓碑 在negativeTTL内再次获取该key时直接返回 ErrNotFound 不再访问源数据
+// 墓碑只占用key的内存 由墓碑缓存单独计算和淘汰 不影响主缓存中的值
+func (g *Group) addTombstone(key string) {
+	if g.negativeTTL <= 0 {
+		return
+	}
+	g.negCache.add(key, ByteView{e: time.Now().Add(g.negativeTTL)})
+}
+
+// 判断key是否有未过期的墓碑 命中时计入统计
+func (g *Group) tombstoned(key string) bool {
+	if g.negativeTTL <= 0 {
+		return false
+	}
+	if _, ok := g.negCache.get(key); ok {
+		g.stats.negativeHits.Add(1)
+		return true
+	}
+	return false
+}
+
+// SetNegativeCache 设置墓碑的过期时长和墓碑缓存的最大内存 ttl<=0时不缓存不存在的key
+// 需要在使用 Group 之前调用 见 WithNegativeCache
+func (g *Group) SetNegativeCache(ttl time.Duration, maxBytes int64) {
+	g.negCache.close()
+	g.negCache = newCache(maxBytes, groupOptions{policy: g.cache.policy, cleanupInterval: g.cache.cleanup})
+	g.negativeTTL = ttl
+}
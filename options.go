@@ -0,0 +1,258 @@
+package gocache
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/consistenthash"
+	"github.com/neijuanxiaozi/gocache/logger"
+	"github.com/neijuanxiaozi/gocache/registry"
+	"github.com/neijuanxiaozi/gocache/tlsutil"
+)
+
+// GroupOption 配置 NewGroup 创建的 Group
+type GroupOption interface {
+	applyGroup(*groupOptions)
+}
+
+// ServerOption 配置 NewServer 创建的 server
+type ServerOption interface {
+	applyServer(*serverOptions)
+}
+
+type groupOptionFunc func(*groupOptions)
+
+func (f groupOptionFunc) applyGroup(o *groupOptions) { f(o) }
+
+type serverOptionFunc func(*serverOptions)
+
+func (f serverOptionFunc) applyServer(o *serverOptions) { f(o) }
+
+// Group 的可选配置 零值字段使用默认值
+type groupOptions struct {
+	ttl             time.Duration  // 缓存值默认的过期时长
+	policy          EvictionPolicy // 主缓存和热点缓存的淘汰策略
+	cleanupInterval time.Duration  // 后台清理过期缓存的时间间隔
+	hotBytes        int64          // 热点缓存的最大内存 <0时使用主缓存的1/8
+	hotRate         float64        // 从远程节点获取的值放入热点缓存的概率
+	replication     int            // 每个key的副本数
+	negativeTTL     time.Duration  // 墓碑的过期时长 <=0表示不缓存不存在的key
+	negativeBytes   int64          // 墓碑缓存的最大内存 <0时使用主缓存的1/16
+	softTTL         time.Duration  // 软过期时长 超过后返回旧值并在后台刷新
+	refreshAhead    time.Duration  // 在软过期或硬过期之前多久开始在命中时后台刷新
+	logger          Logger
+}
+
+func defaultGroupOptions() groupOptions {
+	return groupOptions{
+		policy:        EvictLRU,
+		hotBytes:      -1,
+		replication:   1,
+		negativeTTL:   defaultNegativeTTL,
+		negativeBytes: -1,
+		logger:        currentLogger(),
+	}
+}
+
+// WithTTL 设置缓存值默认的过期时长 0表示永不过期
+func WithTTL(ttl time.Duration) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.ttl = ttl })
+}
+
+// WithEvictionPolicy 设置缓存容量不足时的淘汰策略 默认为 EvictLRU
+func WithEvictionPolicy(policy EvictionPolicy) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.policy = policy })
+}
+
+// WithCleanupInterval 设置后台清理过期缓存的时间间隔 默认1分钟
+func WithCleanupInterval(interval time.Duration) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.cleanupInterval = interval })
+}
+
+// WithHotCache 设置热点缓存的最大内存 以及从远程节点获取的值放入热点缓存的概率 rate<=0时关闭热点缓存
+// 默认最大内存为主缓存的1/8 默认关闭
+// 其他节点上的 Set Delete 不会清除本节点的镜像 镜像在过期或被淘汰前可能返回旧值 只用于可以容忍旧值的数据 并配合 WithTTL 使用
+func WithHotCache(maxBytes int64, rate float64) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) {
+		o.hotBytes = maxBytes
+		o.hotRate = rate
+	})
+}
+
+// WithReplication 设置每个key的副本数 见 Group.SetReplication
+func WithReplication(n int) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.replication = n })
+}
+
+// WithNegativeCache 设置回调函数返回 ErrNotFound 时缓存的墓碑的过期时长 以及墓碑缓存的最大内存
+// ttl<=0时不缓存不存在的key 默认过期时长为5秒 最大内存为主缓存的1/16
+// 从远程节点得知key不存在时本地也会记录墓碑 在ttl内其他节点对该key的写入不一定立即可见
+func WithNegativeCache(ttl time.Duration, maxBytes int64) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) {
+		o.negativeTTL = ttl
+		o.negativeBytes = maxBytes
+	})
+}
+
+// WithSoftTTL 设置缓存值的软过期时长 WithTTL 设置的过期时长是硬过期时长
+// 超过软过期时长后命中时立即返回旧值 同时在后台从源数据刷新 同一个key同时只有一个刷新
+// 超过硬过期时长后值被删除 下一次获取阻塞等待源数据 soft不小于硬过期时长时不生效
+func WithSoftTTL(soft time.Duration) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.softTTL = soft })
+}
+
+// WithRefreshAhead 缓存值在软过期(没有设置时为硬过期)之前window内被命中时 在后台提前刷新
+// 经常被访问的key在过期前就会被刷新 不再经历阻塞的加载 不被访问的key照常过期
+func WithRefreshAhead(window time.Duration) GroupOption {
+	return groupOptionFunc(func(o *groupOptions) { o.refreshAhead = window })
+}
+
+// server 的可选配置 零值字段使用默认值
+type serverOptions struct {
+	registry           registry.Registry        // 注册中心 为nil时按etcdConfig创建etcd注册中心
+	etcdConfig         registry.EtcdConfig      // 创建etcd注册中心的配置
+	weight             int                      // 当前节点的权重
+	replicas           int                      // hash环中真实节点对应虚拟节点个数
+	hash               consistenthash.HashFunc  // 一致性哈希使用的哈希函数 nil表示crc32
+	placement          consistenthash.Placement // 选择key所属节点的策略 设置后忽略replicas和hash
+	boundedLoad        float64                  // 有界负载的epsilon <0表示不启用
+	dialTimeout        time.Duration            // 连接其他节点和etcd的超时时间
+	rpcTimeout         time.Duration            // 调用者没有设置超时时间时rpc的默认超时时间
+	serviceName        string                   // 注册到注册中心的服务名
+	registerTimeout    time.Duration            // 向注册中心注册和注销的超时时间
+	membershipDebounce time.Duration            // 节点变化的防抖时间
+	metricsAddr        string                   // 导出Prometheus指标的http监听地址
+	listenAddr         string                   // 监听rpc请求的地址 为空时监听公布地址
+	serverTLS          *tls.Config              // 不为nil时rpc服务使用TLS
+	clientTLS          *tls.Config              // 不为nil时访问其他节点使用TLS
+	tlsFiles           *tlsutil.Files           // 不为nil时从证书文件创建serverTLS和clientTLS 并自动重新加载
+	auth               *AuthConfig              // 不为nil时rpc服务认证请求方并按ACL授权
+	logger             Logger
+}
+
+func defaultServerOptions() serverOptions {
+	return serverOptions{
+		weight:             1,
+		replicas:           defaultReplicas,
+		boundedLoad:        -1,
+		rpcTimeout:         defaultRPCTimeout,
+		serviceName:        defaultServiceName,
+		registerTimeout:    defaultRegisterTimeout,
+		membershipDebounce: defaultMembershipDebounce,
+		logger:             currentLogger(),
+	}
+}
+
+// WithRegistry 使用指定的注册中心 注册中心由调用者负责关闭
+func WithRegistry(reg registry.Registry) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.registry = reg })
+}
+
+// WithEtcdConfig 没有指定注册中心时 按cfg创建etcd注册中心 server停止时一并关闭
+func WithEtcdConfig(cfg registry.EtcdConfig) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.etcdConfig = cfg })
+}
+
+// WithWeight 设置当前节点的权重 见 server.SetWeight
+func WithWeight(weight int) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.weight = weight })
+}
+
+// WithReplicas 设置hash环中每个真实节点对应的虚拟节点个数 默认50
+func WithReplicas(replicas int) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.replicas = replicas })
+}
+
+// WithHash 设置一致性哈希使用的哈希函数 默认crc32 集群中所有节点必须相同
+func WithHash(fn consistenthash.HashFunc) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.hash = fn })
+}
+
+// WithPlacement 设置选择key所属节点的策略 见 server.SetPlacement
+func WithPlacement(p consistenthash.Placement) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.placement = p })
+}
+
+// WithBoundedLoad 使用有界负载一致性哈希 见 server.SetBoundedLoad
+func WithBoundedLoad(epsilon float64) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.boundedLoad = epsilon })
+}
+
+// WithDialTimeout 设置连接其他节点的超时时间 也用作etcd的连接超时时间(EtcdConfig没有设置时)
+func WithDialTimeout(timeout time.Duration) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.dialTimeout = timeout })
+}
+
+// WithRPCTimeout 设置调用者的ctx没有超时时间时 rpc的默认超时时间 默认10秒
+func WithRPCTimeout(timeout time.Duration) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.rpcTimeout = timeout })
+}
+
+// WithServiceName 设置注册到注册中心的服务名 默认gocache 同一集群的节点必须相同
+func WithServiceName(name string) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.serviceName = name })
+}
+
+// WithRegisterTimeout 设置向注册中心注册和注销的超时时间 默认5秒
+func WithRegisterTimeout(timeout time.Duration) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.registerTimeout = timeout })
+}
+
+// WithMembershipDebounce 设置节点变化的防抖时间 默认500毫秒
+func WithMembershipDebounce(d time.Duration) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.membershipDebounce = d })
+}
+
+// WithMetricsAddr 设置导出Prometheus指标的http监听地址 见 server.SetMetricsAddr
+func WithMetricsAddr(addr string) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.metricsAddr = addr })
+}
+
+// WithListenAddr 设置监听rpc请求的地址 如":6324"监听所有网卡 默认监听 NewServer 的addr
+// NewServer 的addr是对外公布的地址 注册到注册中心并作为hash环上的节点名 在NAT或容器中两者可以不同
+func WithListenAddr(addr string) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.listenAddr = addr })
+}
+
+// WithTLSConfig 节点间的rpc使用TLS server是rpc服务使用的配置 client是访问其他节点使用的配置
+// 两者都需要设置 集群中所有节点必须都启用TLS client没有设置ServerName时使用节点地址中的主机名验证证书
+func WithTLSConfig(server, client *tls.Config) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) {
+		o.serverTLS = server
+		o.clientTLS = client
+	})
+}
+
+// WithTLSFiles 节点间的rpc使用从证书文件加载的TLS配置 files.MutualTLS为true时双向验证证书
+// 证书文件更新后自动重新加载 不需要重启server
+func WithTLSFiles(files tlsutil.Files) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.tlsFiles = &files })
+}
+
+// WithAuth 启用rpc服务的认证和授权 没有通过认证的请求返回 codes.Unauthenticated
+// 没有权限的请求返回 codes.PermissionDenied 见 AuthConfig
+func WithAuth(cfg AuthConfig) ServerOption {
+	return serverOptionFunc(func(o *serverOptions) { o.auth = &cfg })
+}
+
+// Option 是同时可以用于 NewGroup 和 NewServer 的配置
+type Option interface {
+	GroupOption
+	ServerOption
+}
+
+// 同时可以用于 Group 和 server 的日志配置
+type loggerOption struct {
+	logger Logger
+}
+
+func (o loggerOption) applyGroup(opts *groupOptions)   { opts.logger = o.logger }
+func (o loggerOption) applyServer(opts *serverOptions) { opts.logger = o.logger }
+
+// WithLogger 设置 Group 或 server 使用的 Logger l为nil时不输出日志
+func WithLogger(l Logger) Option {
+	if l == nil {
+		l = logger.Nop()
+	}
+	return loggerOption{logger: l}
+}
@@ -0,0 +1,51 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/consistenthash"
+	"github.com/neijuanxiaozi/gocache/logger"
+	"github.com/neijuanxiaozi/gocache/registry"
+)
+
+func TestNewGroup_Options(t *testing.T) {
+	g := NewGroup("options", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithTTL(time.Minute), WithEvictionPolicy(EvictFIFO), WithHotCache(100, 0.5), WithReplication(2), WithLogger(nil))
+	if g.ttl != time.Minute || g.cache.policy != EvictFIFO || g.hotCache.policy != EvictFIFO {
+		t.Errorf("ttl or eviction policy not applied")
+	}
+	if g.hotCache.capacity != 100 || g.hotRate != 0.5 || g.replication != 2 {
+		t.Errorf("hot cache or replication not applied")
+	}
+	if g.logger == nil {
+		t.Errorf("logger should not be nil")
+	}
+	if v, err := g.Get("Tom"); err != nil || v.Expire().IsZero() {
+		t.Errorf("value should expire with the default ttl: %v %v", v, err)
+	}
+}
+
+func TestNewServer_Options(t *testing.T) {
+	hash := func(data []byte) uint32 { return uint32(len(data)) }
+	svr, err := NewServerWithRegistry("127.0.0.1:16329", registry.NewMemory(),
+		WithReplicas(10), WithHash(hash), WithBoundedLoad(0.25), WithRPCTimeout(time.Second),
+		WithServiceName("options"), WithWeight(3), WithLogger(logger.Nop()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svr.consHash.(*consistenthash.Bounded); !ok {
+		t.Fatalf("bounded load placement not applied")
+	}
+	svr.SetPeers("127.0.0.1:16329", "127.0.0.1:16330")
+	if svr.clients["127.0.0.1:16330"].timeout != time.Second {
+		t.Errorf("rpc timeout not applied")
+	}
+	if svr.serviceName != "options" || svr.weight != 3 || svr.replicas != 10 {
+		t.Errorf("server options not applied")
+	}
+	if _, err := NewServerWithRegistry("127.0.0.1:16329", registry.NewMemory(), WithReplicas(0)); err == nil {
+		t.Errorf("zero replicas should be rejected")
+	}
+}
@@ -1,5 +1,7 @@
 package gocache
 
+import "context"
+
 /*
 	该文件实现流程(2) 从远程节点获取缓存值
 	(2)流程:
@@ -10,11 +12,21 @@ package gocache
 */
 
 // Picker 的 Pick() 方法用于根据传入的 key 选择相应的分布式节点
+// PickAll() 返回所有远程节点 用于向整个集群广播失效请求
+// PickReplicas() 按优先级返回key的n个副本节点 列表中的nil表示本节点 没有设置节点时返回空列表
 type Picker interface {
 	Pick(key string) (peer Fetcher, ok bool)
+	PickAll() []Fetcher
+	PickReplicas(key string, n int) []Fetcher
 }
 
-// 接口 Fetcher 的 Fetch() 方法用于从其他节点查找缓存值。
+// 接口 Fetcher 的 Fetch() 方法用于从其他节点查找缓存值 返回值携带远程节点上的过期时间。
+// BatchFetch() 用于在一次rpc中从同一个节点查找多个缓存值 返回每个key的结果。
+// Set() 和 Delete() 用于在远程节点上写入和删除缓存值。
+// ctx 会被传递给rpc调用 用于传递调用者的超时和取消信号
 type Fetcher interface {
-	Fetch(group string, key string) ([]byte, error)
+	Fetch(ctx context.Context, group string, key string) (ByteView, error)
+	BatchFetch(ctx context.Context, group string, keys []string) (map[string]Result, error)
+	Set(ctx context.Context, group string, key string, value []byte) error
+	Delete(ctx context.Context, group string, key string) error
 }
@@ -0,0 +1,104 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/logger"
+)
+
+// 后台刷新获取源数据的超时时间
+const defaultRefreshTimeout = 10 * time.Second
+
+// 用源数据创建缓存值 ttl<=0时使用默认过期时长 设置了软过期时长时同时计算软过期时间
+func (g *Group) newView(bytes []byte, ttl time.Duration) ByteView {
+	v := ByteView{b: cloneBytes(bytes), e: g.expireAt(ttl)}
+	if g.softTTL > 0 {
+		soft := time.Now().Add(g.softTTL)
+		// 软过期时间不早于硬过期时间时 值在过期前不会变旧 不需要软过期
+		if v.e.IsZero() || soft.Before(v.e) {
+			v.s = soft
+		}
+	}
+	return v
+}
+
+// 返回值需要在后台刷新的时间 零值表示不需要刷新
+// 有软过期时间时为软过期时间 否则为硬过期时间 再提前refreshAhead
+func (g *Group) refreshAt(v ByteView) time.Time {
+	at := v.s
+	if at.IsZero() {
+		if g.refreshAhead <= 0 || v.e.IsZero() {
+			return time.Time{}
+		}
+		at = v.e
+	}
+	return at.Add(-g.refreshAhead)
+}
+
+// 主缓存命中时调用 值已经变旧或即将过期时 在后台从源数据刷新 调用者直接使用旧值
+// 同一个key同时只有一个后台刷新 刷新与缓存未命中时的获取经过同一个 singleflight
+// group 关闭后不再刷新 Close 会取消进行中的刷新并等待其结束
+func (g *Group) maybeRefresh(key string, v ByteView) {
+	at := g.refreshAt(v)
+	if at.IsZero() || time.Now().Before(at) {
+		return
+	}
+	if _, loading := g.refreshing.LoadOrStore(key, struct{}{}); loading {
+		return
+	}
+	g.bgMu.Lock()
+	if g.closed {
+		g.bgMu.Unlock()
+		g.refreshing.Delete(key)
+		return
+	}
+	g.bgWG.Add(1)
+	g.bgMu.Unlock()
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer g.bgWG.Done()
+		defer g.refreshing.Delete(key)
+		ctx, cancel := context.WithTimeout(g.bgCtx, defaultRefreshTimeout)
+		defer cancel()
+		if err := g.refresh(ctx, key); err != nil {
+			// key已经不存在 不再返回旧值 其他错误时继续使用旧值直到硬过期
+			if errors.Is(err, ErrNotFound) {
+				g.cache.remove(key)
+			}
+			// group 已经关闭 刷新被取消不是错误
+			if g.bgCtx.Err() != nil {
+				return
+			}
+			g.logger.Warn("failed to refresh", "group", g.name, "key_hash", logger.KeyHash(key), "error", err)
+		}
+	}()
+}
+
+// 经过 singleflight 从本地源刷新key 与 getLocallyOnce 相同 但返回前等待本次发起的获取结束
+// singleflight 在独立的协程中执行获取 ctx取消后仍可能在访问源数据 等待它保证 Close 返回后不再写入缓存
+func (g *Group) refresh(ctx context.Context, key string) error {
+	var mu sync.Mutex
+	var abandoned bool
+	var running sync.WaitGroup
+	_, err := g.flight.Fly(ctx, key, func(ctx context.Context) (interface{}, error) {
+		// 刷新已经返回后才开始执行 说明已经没有调用者在等待 不再访问源数据
+		mu.Lock()
+		if abandoned {
+			mu.Unlock()
+			return ByteView{}, context.Canceled
+		}
+		running.Add(1)
+		mu.Unlock()
+		defer running.Done()
+		defer g.observeLoad(time.Now())
+		return g.getLocally(ctx, key)
+	})
+	mu.Lock()
+	abandoned = true
+	mu.Unlock()
+	running.Wait()
+	return err
+}
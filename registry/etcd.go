@@ -0,0 +1,273 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/logger"
+	"github.com/neijuanxiaozi/gocache/tlsutil"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+)
+
+const (
+	defaultEtcdEndpoint = "localhost:2379" // etcd默认地址
+	defaultDialTimeout  = 5 * time.Second  // etcd默认连接超时时间
+	defaultLeaseTTL     = 5                // 租约默认过期时间 单位秒
+)
+
+// EtcdConfig etcd注册中心的配置 零值字段使用默认值
+type EtcdConfig struct {
+	Endpoints   []string      // etcd集群地址 默认 localhost:2379
+	DialTimeout time.Duration // 连接超时时间 默认5秒
+	TLS         *tls.Config   // 不为nil时使用TLS连接etcd
+	Username    string        // etcd认证用户名
+	Password    string        // etcd认证密码
+	LeaseTTL    int64         // 服务注册租约的过期时间 单位秒 默认5秒
+	Logger      logger.Logger // 日志 为nil时不输出日志
+	// 不为nil且TLS为nil时 使用从证书文件加载的TLS配置连接etcd 证书文件更新后自动重新加载
+	// MutualTLS 对客户端没有意义 设置了CertFile和KeyFile时总是提供客户端证书
+	TLSFiles *tlsutil.Files
+}
+
+// Etcd 是基于etcd的注册中心 服务实例以 service/addr 为key 在租约模式下写入etcd
+type Etcd struct {
+	cli      *clientv3.Client
+	leaseTTL int64
+	mu       sync.Mutex
+	leases   map[string]context.CancelFunc // service/addr -> 停止心跳
+	logger   logger.Logger
+}
+
+// NewEtcd 按配置创建etcd注册中心
+func NewEtcd(cfg EtcdConfig) (*Etcd, error) {
+	if len(cfg.Endpoints) == 0 {
+		cfg.Endpoints = []string{defaultEtcdEndpoint}
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.TLS == nil && cfg.TLSFiles != nil {
+		files := *cfg.TLSFiles
+		files.MutualTLS = false
+		reloader, err := tlsutil.NewReloader(files)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = reloader.ClientConfig()
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+		TLS:         cfg.TLS,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client failed: %v", err)
+	}
+	e := NewEtcdFromClient(cli, cfg.LeaseTTL)
+	if cfg.Logger != nil {
+		e.logger = cfg.Logger
+	}
+	return e, nil
+}
+
+// NewEtcdFromClient 用已有的etcd客户端创建注册中心 Close 时会关闭该客户端
+func NewEtcdFromClient(cli *clientv3.Client, leaseTTL int64) *Etcd {
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+	return &Etcd{cli: cli, leaseTTL: leaseTTL, leases: make(map[string]context.CancelFunc), logger: logger.Nop()}
+}
+
+// Client 返回底层的etcd客户端
+func (e *Etcd) Client() *clientv3.Client {
+	return e.cli
+}
+
+// etcdAdd 在租赁模式添加一对kv至etcd   service是服务名 为gocache
+func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, service string, ep Endpoint) error {
+	// 创建endpoints管理器 用于管理或操作与端点（endpoints）相关的功能。
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return err
+	}
+	// 添加一个endpoint 返回一个error
+	return em.AddEndpoint(c.Ctx(), service+"/"+ep.Addr, endpoints.Endpoint{Addr: ep.Addr, Metadata: ep.Metadata}, clientv3.WithLease(lid))
+}
+
+// 创建租约并在租约上注册服务
+func (e *Etcd) grant(ctx context.Context, service string, ep Endpoint) (clientv3.LeaseID, error) {
+	// 创建一个租约
+	resp, err := e.cli.Grant(ctx, e.leaseTTL)
+	if err != nil {
+		return 0, fmt.Errorf("create lease failed: %v", err)
+	}
+	// 注册服务
+	if err := etcdAdd(e.cli, resp.ID, service, ep); err != nil {
+		return 0, fmt.Errorf("add etcd record failed: %v", err)
+	}
+	return resp.ID, nil
+}
+
+// Register 注册一个服务至etcd 并在后台持续续约
+// 续约中断(如etcd短暂不可用导致租约过期)时会重新注册
+func (e *Etcd) Register(ctx context.Context, service string, ep Endpoint) error {
+	leaseID, err := e.grant(ctx, service, ep)
+	if err != nil {
+		return err
+	}
+	key := service + "/" + ep.Addr
+	keepCtx, cancel := context.WithCancel(context.Background())
+	e.mu.Lock()
+	if stop, ok := e.leases[key]; ok {
+		stop()
+	}
+	e.leases[key] = cancel
+	e.mu.Unlock()
+	go e.keepAlive(keepCtx, service, ep, leaseID)
+	e.logger.Info("service registered", "service", service, "addr", ep.Addr)
+	return nil
+}
+
+// 保持租约心跳 心跳管道关闭后重新注册 直到ctx结束
+func (e *Etcd) keepAlive(ctx context.Context, service string, ep Endpoint, leaseID clientv3.LeaseID) {
+	for {
+		// 设置服务心跳检测
+		ch, err := e.cli.KeepAlive(ctx, leaseID)
+		if err == nil {
+			for range ch {
+			}
+		}
+		if ctx.Err() != nil {
+			// 注销时撤销租约 服务记录随租约一起删除
+			revokeCtx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+			e.cli.Revoke(revokeCtx, leaseID)
+			cancel()
+			return
+		}
+		e.logger.Warn("keep alive channel closed, re-register", "service", service, "addr", ep.Addr)
+		// 租约已丢失 间隔一段时间后重新注册
+		for {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			if leaseID, err = e.grant(ctx, service, ep); err == nil {
+				break
+			}
+			e.logger.Error("re-register failed", "service", service, "addr", ep.Addr, "error", err)
+		}
+	}
+}
+
+// Deregister 停止续约并撤销租约 服务记录随之删除
+func (e *Etcd) Deregister(ctx context.Context, service string, addr string) error {
+	key := service + "/" + addr
+	e.mu.Lock()
+	stop, ok := e.leases[key]
+	delete(e.leases, key)
+	e.mu.Unlock()
+	if ok {
+		stop()
+	}
+	em, err := endpoints.NewManager(e.cli, service)
+	if err != nil {
+		return err
+	}
+	return em.DeleteEndpoint(ctx, key)
+}
+
+// Watch 监听 service/ 前缀下的服务实例变化
+func (e *Etcd) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	em, err := endpoints.NewManager(e.cli, service)
+	if err != nil {
+		return nil, err
+	}
+	wch, err := em.NewWatchChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []Endpoint)
+	go func() {
+		defer close(ch)
+		current := make(map[string]Endpoint)
+		for updates := range wch {
+			for _, up := range updates {
+				switch up.Op {
+				case endpoints.Add:
+					current[up.Key] = toEndpoint(up.Endpoint)
+				case endpoints.Delete:
+					delete(current, up.Key)
+				}
+			}
+			eps := make([]Endpoint, 0, len(current))
+			for _, ep := range current {
+				eps = append(eps, ep)
+			}
+			sortEndpoints(eps)
+			select {
+			case ch <- eps:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Resolve 列出 service/ 前缀下的全部服务实例
+func (e *Etcd) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	em, err := endpoints.NewManager(e.cli, service)
+	if err != nil {
+		return nil, err
+	}
+	m, err := em.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	eps := make([]Endpoint, 0, len(m))
+	for _, ep := range m {
+		eps = append(eps, toEndpoint(ep))
+	}
+	sortEndpoints(eps)
+	return eps, nil
+}
+
+// Close 停止所有续约并关闭etcd客户端
+func (e *Etcd) Close() error {
+	e.mu.Lock()
+	for key, stop := range e.leases {
+		stop()
+		delete(e.leases, key)
+	}
+	e.mu.Unlock()
+	return e.cli.Close()
+}
+
+// etcd中的Metadata经过json编码 读取出来是map[string]interface{}
+func toEndpoint(ep endpoints.Endpoint) Endpoint {
+	out := Endpoint{Addr: ep.Addr}
+	switch md := ep.Metadata.(type) {
+	case map[string]string:
+		out.Metadata = md
+	case map[string]interface{}:
+		out.Metadata = make(map[string]string, len(md))
+		for k, v := range md {
+			out.Metadata[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+func sortEndpoints(eps []Endpoint) {
+	sort.Slice(eps, func(i, j int) bool { return eps[i].Addr < eps[j].Addr })
+}
+
+var _ Registry = (*Etcd)(nil)
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory 是进程内的注册中心 多个server共享同一个 Memory 即可互相发现 主要用于测试
+type Memory struct {
+	mu       sync.Mutex
+	services map[string]map[string]Endpoint // service -> addr -> 实例
+	watchers map[string][]chan []Endpoint   // service -> 监听者
+}
+
+// NewMemory 创建一个空的进程内注册中心
+func NewMemory() *Memory {
+	return &Memory{
+		services: make(map[string]map[string]Endpoint),
+		watchers: make(map[string][]chan []Endpoint),
+	}
+}
+
+func (m *Memory) Register(ctx context.Context, service string, ep Endpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.services[service] == nil {
+		m.services[service] = make(map[string]Endpoint)
+	}
+	m.services[service][ep.Addr] = ep
+	m.notify(service)
+	return nil
+}
+
+func (m *Memory) Deregister(ctx context.Context, service string, addr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.services[service][addr]; !ok {
+		return nil
+	}
+	delete(m.services[service], addr)
+	m.notify(service)
+	return nil
+}
+
+func (m *Memory) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan []Endpoint, 1)
+	ch <- m.list(service)
+	m.watchers[service] = append(m.watchers[service], ch)
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		watchers := m.watchers[service]
+		for i, w := range watchers {
+			if w == ch {
+				m.watchers[service] = append(watchers[:i], watchers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (m *Memory) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(service), nil
+}
+
+// Close 关闭所有监听管道
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, watchers := range m.watchers {
+		for _, ch := range watchers {
+			close(ch)
+		}
+	}
+	m.watchers = make(map[string][]chan []Endpoint)
+	return nil
+}
+
+// 按地址排序返回服务的全部实例 调用者需持有锁
+func (m *Memory) list(service string) []Endpoint {
+	eps := make([]Endpoint, 0, len(m.services[service]))
+	for _, ep := range m.services[service] {
+		eps = append(eps, ep)
+	}
+	sort.Slice(eps, func(i, j int) bool { return eps[i].Addr < eps[j].Addr })
+	return eps
+}
+
+// 将最新的实例列表发送给所有监听者 管道中旧的列表会被替换 调用者需持有锁
+func (m *Memory) notify(service string) {
+	eps := m.list(service)
+	for _, ch := range m.watchers[service] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- eps
+	}
+}
+
+var _ Registry = (*Memory)(nil)
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"context"
+	"strconv"
+)
+
+// MetadataWeight 是 Endpoint.Metadata 中节点权重的key 值为正整数的字符串
+const MetadataWeight = "weight"
+
+// Endpoint 是注册到注册中心的一个服务实例
+type Endpoint struct {
+	Addr     string            // 服务实例的地址 ip:port
+	Metadata map[string]string // 附加信息 如节点权重
+}
+
+// Weight 返回实例的权重 没有设置或格式不正确时返回1
+func (ep Endpoint) Weight() int {
+	weight, err := strconv.Atoi(ep.Metadata[MetadataWeight])
+	if err != nil || weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// Registry 服务注册与发现的接口 server通过它注册自己并发现其他节点
+// 提供etcd 静态节点列表 内存三种实现 也可以自行实现以接入其他注册中心
+type Registry interface {
+	// Register 注册一个服务实例 并在后台保持注册状态 直到 Deregister 或 Close
+	Register(ctx context.Context, service string, ep Endpoint) error
+	// Deregister 注销一个服务实例
+	Deregister(ctx context.Context, service string, addr string) error
+	// Watch 监听服务实例的变化 每次变化时发送当前全部实例 ctx结束时关闭管道
+	Watch(ctx context.Context, service string) (<-chan []Endpoint, error)
+	// Resolve 返回服务当前的全部实例
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+	// Close 释放注册中心占用的资源
+	Close() error
+}
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemory_Watch(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.Watch(ctx, "gocache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eps := <-ch; len(eps) != 0 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(eps), 0)
+	}
+	m.Register(ctx, "gocache", Endpoint{Addr: "127.0.0.1:6324"})
+	m.Register(ctx, "gocache", Endpoint{Addr: "127.0.0.1:6325"})
+	m.Deregister(ctx, "gocache", "127.0.0.1:6324")
+	// 监听管道只保留最新的实例列表
+	eps := <-ch
+	if len(eps) != 1 || eps[0].Addr != "127.0.0.1:6325" {
+		t.Fatalf("Actual: %v\tExpect: [127.0.0.1:6325]", eps)
+	}
+	resolved, _ := m.Resolve(ctx, "gocache")
+	if len(resolved) != 1 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(resolved), 1)
+	}
+}
+
+func TestStatic_Resolve(t *testing.T) {
+	s := NewStatic("127.0.0.1:6324", "127.0.0.1:6325")
+	eps, _ := s.Resolve(context.Background(), "gocache")
+	if len(eps) != 2 || eps[0].Addr != "127.0.0.1:6324" {
+		t.Fatalf("Actual: %v", eps)
+	}
+}
@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"context"
+	"sync"
+)
+
+// Static 是固定节点列表的注册中心 不依赖任何外部服务
+// Register 和 Deregister 只修改本地列表 适合节点固定的部署
+type Static struct {
+	mu        sync.Mutex
+	endpoints []Endpoint
+}
+
+// NewStatic 用固定的节点地址创建注册中心
+func NewStatic(addrs ...string) *Static {
+	s := &Static{}
+	for _, addr := range addrs {
+		s.endpoints = append(s.endpoints, Endpoint{Addr: addr})
+	}
+	return s
+}
+
+func (s *Static) Register(ctx context.Context, service string, ep Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.endpoints {
+		if s.endpoints[i].Addr == ep.Addr {
+			s.endpoints[i] = ep
+			return nil
+		}
+	}
+	s.endpoints = append(s.endpoints, ep)
+	return nil
+}
+
+func (s *Static) Deregister(ctx context.Context, service string, addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.endpoints {
+		if s.endpoints[i].Addr == addr {
+			s.endpoints = append(s.endpoints[:i], s.endpoints[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Watch 发送一次当前的节点列表 之后不再变化
+func (s *Static) Watch(ctx context.Context, service string) (<-chan []Endpoint, error) {
+	eps, _ := s.Resolve(ctx, service)
+	ch := make(chan []Endpoint, 1)
+	ch <- eps
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (s *Static) Resolve(ctx context.Context, service string) ([]Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	eps := make([]Endpoint, len(s.endpoints))
+	copy(eps, s.endpoints)
+	return eps, nil
+}
+
+func (s *Static) Close() error {
+	return nil
+}
+
+var _ Registry = (*Static)(nil)
@@ -2,146 +2,536 @@ package gocache
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
 	"net"
-	"strings"
+	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/neijuanxiaozi/gocache/consistenthash"
 	pb "github.com/neijuanxiaozi/gocache/gocachepb"
+	"github.com/neijuanxiaozi/gocache/logger"
 	"github.com/neijuanxiaozi/gocache/registry"
+	"github.com/neijuanxiaozi/gocache/tlsutil"
 	"github.com/neijuanxiaozi/gocache/utils"
-	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
-	defaultAddr     = "127.0.0.1:6324" // 当前节点默认地址
-	defaultReplicas = 50               // hash环中真实节点对应虚拟节点个数
-)
-
-// etcd 默认配置对象 包含了etcd的ip和port etcd连接超时时间为5秒
-var (
-	defaultEtcdConfig = clientv3.Config{
-		Endpoints:   []string{"localhost:2379"},
-		DialTimeout: 5 * time.Second,
-	}
+	defaultAddr            = "127.0.0.1:6324" // 当前节点默认地址
+	defaultReplicas        = 50               // hash环中真实节点对应虚拟节点个数
+	defaultServiceName     = "gocache"        // 注册到注册中心的服务名
+	defaultRegisterTimeout = 5 * time.Second  // 向注册中心注册和注销的超时时间
 )
 
 // gocache的网络模块中的服务端模块 负责等待其他节点的rpc请求 或者客户端的请求 server与cache是解耦的
 type server struct {
-	addr                           string                         // 当前节点的ip和port
-	status                         bool                           // 当前节点是否运行
-	stopSignal                     chan error                     // 通知registry revoke服务 作用未知
-	mu                             sync.Mutex                     // 操作一致性哈希时 加锁
-	consHash                       *consistenthash.Consistentency // 一致性hash
-	clients                        map[string]*client             // 其他节点
-	*pb.UnimplementedGoCacheServer                                // 实现grpc需要
+	addr                           string                   // 当前节点对外公布的地址 host:port 注册到注册中心并作为hash环上的节点名
+	weight                         int                      // 当前节点的权重 通过注册中心告知其他节点
+	status                         bool                     // 当前节点是否运行
+	listenAddr                     string                   // 监听地址 为空时监听addr
+	boundAddr                      string                   // 实际监听的地址 启动后设置
+	grpcServer                     *grpc.Server             // 处理rpc请求的grpc服务 停止时关闭
+	serverTLS                      *tls.Config              // 不为nil时rpc服务使用TLS
+	clientTLS                      *tls.Config              // 不为nil时访问其他节点使用TLS
+	auth                           *AuthConfig              // 不为nil时rpc服务认证请求方并按ACL授权
+	done                           chan struct{}            // rpc服务退出时关闭
+	serveErr                       error                    // rpc服务异常退出的错误
+	mu                             sync.Mutex               // 操作一致性哈希时 加锁
+	consHash                       consistenthash.Placement // 选择key所属节点的策略 默认为一致性哈希环
+	clients                        map[string]*client       // 其他节点
+	registry                       registry.Registry        // 注册中心 启动时注册自己 停止时注销
+	ownRegistry                    bool                     // 注册中心是否由server创建 是则停止时一并关闭 重新启动时重新创建
+	etcdConfig                     registry.EtcdConfig      // 创建etcd注册中心的配置
+	stopping                       bool                     // 正在停止 停止完成前不能重新启动
+	stopWatch                      context.CancelFunc       // 停止监听注册中心的节点变化
+	onMembership                   MembershipFunc           // 节点变化时的回调
+	metricsAddr                    string                   // 导出Prometheus指标的http监听地址 为空时不导出
+	metricsSrv                     *http.Server             // 导出指标的http服务
+	logger                         Logger                   // 日志 默认使用创建时 SetLogger 设置的 Logger
+	replicas                       int                      // hash环中真实节点对应虚拟节点个数
+	hash                           consistenthash.HashFunc  // 一致性哈希使用的哈希函数 nil表示crc32
+	dialTimeout                    time.Duration            // 连接其他节点的超时时间 0表示使用grpc的默认值
+	rpcTimeout                     time.Duration            // 调用者没有设置超时时间时rpc的默认超时时间
+	serviceName                    string                   // 注册到注册中心的服务名
+	registerTimeout                time.Duration            // 向注册中心注册和注销的超时时间
+	membershipDebounce             time.Duration            // 节点变化的防抖时间
+	*pb.UnimplementedGoCacheServer                          // 实现grpc需要
 }
 
-// 创建一个server实例
-func NewServer(addr string) (*server, error) {
+// 创建一个server实例 默认使用 localhost:2379 上的etcd作为注册中心
+// opts 可以设置注册中心 节点选择策略 超时时间等 如 NewServer(addr, WithRegistry(reg), WithReplicas(100))
+func NewServer(addr string, opts ...ServerOption) (*server, error) {
+	o := defaultServerOptions()
+	for _, opt := range opts {
+		opt.applyServer(&o)
+	}
 	if addr == "" {
 		addr = defaultAddr
 	}
-	if !utils.ValidPeerAddr(addr) {
-		return nil, fmt.Errorf("invalid addr %s, it should be x.x.x.x:port", addr)
+	if !utils.ValidAdvertiseAddr(addr) {
+		return nil, fmt.Errorf("invalid addr %s, it should be host:port", addr)
+	}
+	if o.listenAddr != "" && !utils.ValidListenAddr(o.listenAddr) {
+		return nil, fmt.Errorf("invalid listen addr %s, it should be [host]:port", o.listenAddr)
+	}
+	if o.replicas <= 0 {
+		return nil, fmt.Errorf("invalid replicas %d", o.replicas)
+	}
+	if o.weight <= 0 {
+		o.weight = 1
+	}
+	s := &server{
+		addr:               addr,
+		weight:             o.weight,
+		registry:           o.registry,
+		replicas:           o.replicas,
+		hash:               o.hash,
+		consHash:           o.placement,
+		dialTimeout:        o.dialTimeout,
+		rpcTimeout:         o.rpcTimeout,
+		serviceName:        o.serviceName,
+		registerTimeout:    o.registerTimeout,
+		membershipDebounce: o.membershipDebounce,
+		metricsAddr:        o.metricsAddr,
+		logger:             o.logger,
+		listenAddr:         o.listenAddr,
+		serverTLS:          o.serverTLS,
+		clientTLS:          o.clientTLS,
+		auth:               o.auth,
+	}
+	if o.tlsFiles != nil {
+		reloader, err := tlsutil.NewReloader(*o.tlsFiles)
+		if err != nil {
+			return nil, err
+		}
+		s.serverTLS, s.clientTLS = reloader.ServerConfig(), reloader.ClientConfig()
+	}
+	if (s.serverTLS == nil) != (s.clientTLS == nil) {
+		return nil, fmt.Errorf("both server and client tls config are required")
+	}
+	if s.auth != nil && s.auth.MutualTLS && s.serverTLS == nil {
+		return nil, fmt.Errorf("auth with mutual tls identity requires tls config")
+	}
+	if s.auth != nil && s.auth.PeerToken != "" && !s.auth.InsecurePeerToken && s.clientTLS == nil {
+		return nil, fmt.Errorf("auth peer token requires tls config")
+	}
+	if o.placement == nil && o.boundedLoad >= 0 {
+		s.consHash = consistenthash.NewBounded(s.replicas, o.boundedLoad, s.hash)
+	}
+	// 没有指定注册中心时 创建etcd注册中心 停止时一并关闭
+	if s.registry == nil {
+		cfg := o.etcdConfig
+		if cfg.DialTimeout <= 0 {
+			cfg.DialTimeout = o.dialTimeout
+		}
+		if cfg.Logger == nil {
+			cfg.Logger = o.logger
+		}
+		s.etcdConfig = cfg
+		s.ownRegistry = true
+		if err := s.openRegistry(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// 按etcdConfig创建server自己的注册中心 调用者需持有锁或者server还未被使用
+func (s *server) openRegistry() error {
+	reg, err := registry.NewEtcd(s.etcdConfig)
+	if err != nil {
+		return err
+	}
+	s.registry = reg
+	return nil
+}
+
+// 创建一个使用指定注册中心的server实例 注册中心由调用者负责关闭 等同于 NewServer(addr, WithRegistry(reg))
+func NewServerWithRegistry(addr string, reg registry.Registry, opts ...ServerOption) (*server, error) {
+	if reg == nil {
+		return nil, fmt.Errorf("registry is nil")
+	}
+	return NewServer(addr, append(opts[:len(opts):len(opts)], WithRegistry(reg))...)
+}
+
+// SetLogger 设置server使用的 Logger l为nil时不输出日志 需要在Start之前调用
+func (s *server) SetLogger(l Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l == nil {
+		l = logger.Nop()
+	}
+	s.logger = l
+}
+
+// SetWeight 设置当前节点的权重 需要在Start之前调用
+// 权重随注册信息告知其他节点 节点在hash环上的虚拟节点个数与权重成正比 使key的分布与节点容量相符
+func (s *server) SetWeight(weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if weight <= 0 {
+		weight = 1
+	}
+	s.weight = weight
+}
+
+// SetBoundedLoad 使用有界负载一致性哈希选择节点 需要在SetPeers和Start之前调用
+// 每个节点的负载(发往该节点的进行中请求数 本节点为自己获取数据的请求数)上限为(1+epsilon)倍的平均负载
+// 超过上限时读请求溢出到环上的下一个节点 写入和删除总是发往环上固定的所属节点
+func (s *server) SetBoundedLoad(epsilon float64) error {
+	if epsilon < 0 {
+		return fmt.Errorf("invalid epsilon %v", epsilon)
 	}
-	return &server{addr: addr}, nil
+	return s.SetPlacement(consistenthash.NewBounded(s.replicas, epsilon, s.hash))
 }
 
-// 将其他节点设置到hash环上
+// SetPlacement 设置选择key所属节点的策略 如 consistenthash.NewRendezvous(nil) 需要在SetPeers和Start之前调用
+// 集群中所有节点必须使用相同的策略 否则同一个key在不同节点上会选出不同的节点
+func (s *server) SetPlacement(p consistenthash.Placement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p == nil {
+		return fmt.Errorf("placement is nil")
+	}
+	if s.consHash != nil && len(s.consHash.Peers()) > 0 {
+		return fmt.Errorf("placement must be set before peers")
+	}
+	s.consHash = p
+	return nil
+}
+
+// 将其他节点设置到hash环上 所有节点的权重为1
 func (s *server) SetPeers(peersAddr ...string) {
+	peers := make(map[string]int, len(peersAddr))
+	for _, peerAddr := range peersAddr {
+		peers[peerAddr] = 1
+	}
+	s.SetWeightedPeers(peers)
+}
+
+// 将带权重的节点设置到hash环上 peers的key是节点地址 值是节点权重
+func (s *server) SetWeightedPeers(peers map[string]int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	// 创建一致性hash实例
-	s.consHash = consistenthash.New(defaultReplicas, nil)
-	// 将其他节点设置到hash环上
-	s.consHash.Register(peersAddr...)
+	s.setPeers(peers)
+}
+
+// SetWeightedPeers 的实现 调用者需持有锁
+// hash环只增删发生变化的节点 不重建整个环
+func (s *server) setPeers(peers map[string]int) {
+	// 第一次设置时创建一致性hash实例
+	if s.consHash == nil {
+		s.consHash = consistenthash.New(s.replicas, s.hash)
+	}
 	// 创建客户端map 记录访问其他节点的客户端实例
-	s.clients = make(map[string]*client)
+	clients := make(map[string]*client)
 	// 为访问其他节点 创建每个节点对应的客户端 用对应节点的客户端实例访问其他节点
-	for _, peerAddr := range peersAddr {
-		if !utils.ValidPeerAddr(peerAddr) {
-			panic(fmt.Sprintf("[peer %s] invalid address format, it should be x.x.x.x:port", peerAddr))
+	// 仍然存在的节点复用原有客户端及其连接
+	for peerAddr := range peers {
+		// 自己的地址端口可以为0 启动后替换为实际监听的端口
+		if peerAddr != s.addr && !utils.ValidPeerAddr(peerAddr) {
+			panic(fmt.Sprintf("[peer %s] invalid address format, it should be host:port", peerAddr))
+		}
+		if c, ok := s.clients[peerAddr]; ok {
+			clients[peerAddr] = c
+			continue
+		}
+		c := NewClient(peerAddr, s.dial)
+		if s.rpcTimeout > 0 {
+			c.timeout = s.rpcTimeout
+		}
+		// 启用有界负载时 客户端在每次rpc前后报告该节点的负载
+		if bounded, ok := s.consHash.(*consistenthash.Bounded); ok {
+			c.loads = bounded
+		}
+		clients[peerAddr] = c
+	}
+	// 从hash环上删除已被移除的节点 并关闭其连接
+	for _, peerAddr := range s.consHash.Peers() {
+		if _, ok := clients[peerAddr]; !ok {
+			s.consHash.Remove(peerAddr)
+		}
+	}
+	for peerAddr, c := range s.clients {
+		if _, ok := clients[peerAddr]; !ok {
+			c.Close()
 		}
-		s.clients[peerAddr] = NewClient(fmt.Sprintf("gocache/%s", peerAddr))
 	}
+	// 将新节点一次设置到hash环上 权重没有变化的已有节点会被忽略
+	consistenthash.RegisterAll(s.consHash, peers)
+	s.clients = clients
+}
+
+// 估计非哈希环策略的key分布时使用的样本数
+const distributionSamples = 10000
+
+// RingDistribution 返回每个节点拥有的key的比例 用于确认key的分布与节点权重相符
+// 哈希环按哈希空间精确计算 其他策略用样本key估计
+func (s *server) RingDistribution() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.consHash == nil {
+		return map[string]float64{}
+	}
+	if ring, ok := s.consHash.(interface{ Distribution() map[string]float64 }); ok {
+		return ring.Distribution()
+	}
+	return consistenthash.Distribution(s.consHash, distributionSamples)
+}
+
+// 建立与其他节点的grpc连接 节点地址已经由注册中心或SetPeers给出 直接连接该地址
+func (s *server) dial(peerAddr string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if s.clientTLS != nil {
+		creds = credentials.NewTLS(s.clientTLS)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if s.auth != nil && s.auth.PeerToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: s.auth.PeerToken, insecure: s.auth.InsecurePeerToken}))
+	}
+	if s.dialTimeout > 0 {
+		opts = append(opts, grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: s.dialTimeout,
+		}))
+	}
+	return grpc.NewClient(peerAddr, opts...)
 }
 
 // 用key在hash环上找到对应节点 并返回对应节点的客户端
 func (s *server) Pick(key string) (Fetcher, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	// 还没有设置节点
+	if s.consHash == nil {
+		return nil, false
+	}
 	// 获取要访问节点的ip和端口
 	peerAddr := s.consHash.GetPeer(key)
 	// 要访问的节点是自己
-	if peerAddr == s.addr {
-		log.Printf("pick self, %s", s.addr)
+	if peerAddr == "" || peerAddr == s.addr {
 		return nil, false
 	}
-	log.Printf("[cache %s] pick remote peer: %s", s.addr, peerAddr)
+	if debugEnabled(s.logger) {
+		s.logger.Debug("pick remote peer", "addr", s.addr, "key_hash", logger.KeyHash(key), "peer", peerAddr)
+	}
 	// 返回对应节点的客户端实例
 	return s.clients[peerAddr], true
 }
 
+// 返回所有远程节点的客户端 不包括自己
+func (s *server) PickAll() []Fetcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fetchers := make([]Fetcher, 0, len(s.clients))
+	for peerAddr, c := range s.clients {
+		if peerAddr == s.addr {
+			continue
+		}
+		fetchers = append(fetchers, c)
+	}
+	return fetchers
+}
+
+// 按优先级返回key的n个副本节点的客户端 本节点用nil表示
+func (s *server) PickReplicas(key string, n int) []Fetcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.consHash == nil {
+		return nil
+	}
+	peerAddrs := s.consHash.GetPeers(key, n)
+	fetchers := make([]Fetcher, 0, len(peerAddrs))
+	for _, peerAddr := range peerAddrs {
+		if peerAddr == s.addr {
+			fetchers = append(fetchers, nil)
+			continue
+		}
+		fetchers = append(fetchers, s.clients[peerAddr])
+	}
+	return fetchers
+}
+
+// 启用有界负载时 本节点为自己获取数据计入本节点的负载 使本节点也受负载上限约束
+func (s *server) beginLocalLoad() (end func()) {
+	s.mu.Lock()
+	bounded, ok := s.consHash.(*consistenthash.Bounded)
+	addr := s.addr
+	s.mu.Unlock()
+	if !ok {
+		return func() {}
+	}
+	bounded.Begin(addr)
+	return func() { bounded.End(addr) }
+}
+
+// 创建监听的函数 测试中可以替换
+var listen = net.Listen
+
 // 断言server是否是Picker接口
 var _ Picker = (*server)(nil)
 
-// 启动start 将服务注册到etcd上 并监听客户端请求(注意是客户端的请求 不是其他节点的请求 其他节点的访问是通过grpc)
-func (s *server) Start() error {
+// 启动start 将服务注册到注册中心 并在后台处理其他节点的rpc请求 注册成功后返回
+// ctx 用于控制注册的超时 没有设置超时时间时使用默认的注册超时时间 可以用 Wait 等待server停止
+func (s *server) Start(ctx context.Context) error {
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	//已经启动过
-	if s.status == true {
-		s.mu.Unlock()
+	if s.status {
 		return fmt.Errorf("server already started")
 	}
+	if s.stopping {
+		return fmt.Errorf("server is stopping")
+	}
+	// 自己创建的注册中心在上次停止时已经关闭 重新创建
+	if s.ownRegistry && s.registry == nil {
+		if err := s.openRegistry(); err != nil {
+			return err
+		}
+	}
 	// -----------------启动服务----------------------
-	// 1. 设置status为true 表示服务器已在运行
-	// 2. 初始化stop channal,这用于通知registry stop keep alive
-	// 3. 初始化tcp socket并开始监听
-	// 4. 注册rpc服务至grpc 这样grpc收到request可以分发给server处理
-	// 5. 将自己的服务名/Host地址注册至etcd 这样client可以通过etcd
-	//    获取服务Host地址 从而进行通信。这样的好处是client只需知道服务名
-	//    以及etcd的Host即可获取对应服务IP 无需写死至client代码中
+	// 1. 初始化tcp socket并开始监听
+	// 2. 注册rpc服务至grpc 这样grpc收到request可以分发给server处理
+	// 3. 将自己的服务名/Host地址注册至注册中心 这样其他节点可以通过注册中心
+	//    获取服务Host地址 从而进行通信。这样的好处是其他节点只需知道服务名
+	//    以及注册中心的地址即可获取对应服务IP 无需写死至代码中
+	// 4. 设置status为true 表示服务器已在运行
 	// ----------------------------------------------
-
-	//设置当前节点运行状态为true
-	s.status = true
-	// 创建stop channal 作用未知
-	s.stopSignal = make(chan error)
-	port := strings.Split(s.addr, ":")[1]
-	lis, err := net.Listen("tcp", ":"+port)
+	listenAddr := s.listenAddr
+	if listenAddr == "" {
+		listenAddr = s.addr
+	}
+	lis, err := listen("tcp", listenAddr)
 	if err != nil {
 		return fmt.Errorf("faild to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	// 公布地址的端口为0时 使用系统分配的端口作为公布地址 注册成功后才更新s.addr
+	addr := s.advertisedAddr(lis.Addr())
+	var serverOpts []grpc.ServerOption
+	if s.serverTLS != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.serverTLS)))
+	}
+	if s.auth != nil {
+		serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(s.auth.unaryInterceptor()))
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
 	pb.RegisterGoCacheServer(grpcServer, s)
+	if err := s.startMetrics(); err != nil {
+		lis.Close()
+		return err
+	}
 
-	// 注册服务至etcd 并持续监听etcd之间的心跳
+	// 注册服务至注册中心 注册中心在后台维持心跳
+	ctx, cancel := s.withRegisterTimeout(ctx)
+	err = s.registry.Register(ctx, s.serviceName, registry.Endpoint{
+		Addr:     addr,
+		Metadata: map[string]string{registry.MetadataWeight: strconv.Itoa(s.weight)},
+	})
+	cancel()
+	if err != nil {
+		lis.Close()
+		s.stopMetrics()
+		return fmt.Errorf("failed to register: %v", err)
+	}
+	s.advertise(addr, lis.Addr())
+	//设置当前节点运行状态为true
+	s.status = true
+	s.grpcServer = grpcServer
+	// 监听注册中心 节点加入或离开时自动更新hash环
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	s.stopWatch = stopWatch
+	go s.watchPeers(watchCtx, s.registry)
+	// 在后台启动rpc服务
+	done := make(chan struct{})
+	s.done = done
+	s.serveErr = nil
 	go func() {
-		//TODO
-		err := registry.Register("gocache", s.addr, s.stopSignal)
-		if err != nil {
-			log.Fatalf(err.Error())
-		}
-		// 关闭管道
-		close(s.stopSignal)
-		// 关闭tcp listen
-		err = lis.Close()
-		if err != nil {
-			log.Fatalf(err.Error())
+		defer close(done)
+		if err := grpcServer.Serve(lis); err != nil {
+			s.logger.Error("rpc server stopped", "addr", addr, "error", err)
+			s.mu.Lock()
+			s.serveErr = err
+			s.mu.Unlock()
+			// rpc服务异常退出 从注册中心注销并停止监听 避免其他节点继续选择本节点
+			s.stop(context.Background(), false, false)
 		}
-		log.Printf("[%s] Revoke service and close tcp socket ok.", s.addr)
 	}()
+	s.logger.Info("server started", "addr", s.addr)
+	return nil
+}
+
+// 返回对外公布的地址 公布地址的端口为0时替换为实际监听的端口
+func (s *server) advertisedAddr(bound net.Addr) string {
+	host, port, _ := net.SplitHostPort(s.addr)
+	if port != "0" {
+		return s.addr
+	}
+	_, boundPort, _ := net.SplitHostPort(bound.String())
+	return net.JoinHostPort(host, boundPort)
+}
+
+// 记录实际监听的地址和对外公布的地址 公布地址改变时更新hash环上自己的节点名 调用者需持有锁
+func (s *server) advertise(addr string, bound net.Addr) {
+	s.boundAddr = bound.String()
+	if addr == s.addr {
+		return
+	}
+	oldAddr := s.addr
+	s.addr = addr
+	if _, ok := s.clients[oldAddr]; !ok {
+		return
+	}
+	peers := make(map[string]int, len(s.clients))
+	for peerAddr := range s.clients {
+		if peerAddr != oldAddr {
+			peers[peerAddr] = s.consHash.Weight(peerAddr)
+		}
+	}
+	peers[s.addr] = s.weight
+	s.setPeers(peers)
+}
+
+// Addr 返回当前节点对外公布的地址 端口为0时 启动后返回使用实际端口的地址
+func (s *server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// ListenAddr 返回实际监听的地址 server没有启动时返回空字符串
+func (s *server) ListenAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.boundAddr
+}
+
+// Wait 阻塞直到server停止 返回rpc服务异常退出的错误 server没有启动时立即返回
+func (s *server) Wait() error {
+	s.mu.Lock()
+	done := s.done
 	s.mu.Unlock()
-	// 启动rpc服务
-	if err := grpcServer.Serve(lis); err != nil && s.status {
-		return fmt.Errorf("failed to server: %v", err)
+	if done == nil {
+		return nil
 	}
-	return nil
+	<-done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serveErr
+}
+
+// ctx没有设置超时时间时 使用注册中心操作的默认超时时间
+func (s *server) withRegisterTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.registerTimeout)
 }
 
 // rpc方法
@@ -151,35 +541,251 @@ func (s *server) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, e
 	// 创建rpc方法响应实例
 	resp := &pb.GetResponse{}
 
-	log.Printf("[gocache_svr %s] Recv RPC - (%s)/(%s)", s.addr, group, key)
+	if debugEnabled(s.logger) {
+		s.logger.Debug("recv rpc", "method", "Get", "group", group, "key_hash", logger.KeyHash(key))
+	}
 	if key == "" {
-		return resp, fmt.Errorf("empty key")
+		return resp, toStatus(ErrEmptyKey)
 	}
 	// 根据group name 拿到group
 	g := GetGroup(group)
 	if g == nil {
-		return resp, fmt.Errorf("group is not found")
+		return resp, toStatus(fmt.Errorf("%w: %s", ErrGroupNotFound, group))
 	}
-	// 在group中根据key获得数据ByteView
-	view, err := g.Get(key)
+	// 在group中根据key获得数据ByteView 使用请求方传来的ctx 请求方超时或取消后不再继续加载
+	// 请求方已经选定了本节点 未命中时从本地获取 不再转发
+	view, err := g.getForPeer(ctx, key)
 	if err != nil {
-		return resp, err
+		return resp, toStatus(err)
 	}
 	// 赋值给resp
 	resp.Value = view.ByteSlice()
+	if expire := view.Expire(); !expire.IsZero() {
+		resp.ExpireAt = expire.UnixNano()
+	}
 	return resp, err
 }
 
-// Stop停止server
+// rpc方法 批量获取同一个group中的多个key 每个key的错误单独返回
+func (s *server) BatchGet(ctx context.Context, in *pb.BatchGetRequest) (*pb.BatchGetResponse, error) {
+	group, keys := in.GetGroup(), in.GetKeys()
+	resp := &pb.BatchGetResponse{}
+
+	if debugEnabled(s.logger) {
+		s.logger.Debug("recv rpc", "method", "BatchGet", "group", group, "keys", len(keys))
+	}
+	g := GetGroup(group)
+	if g == nil {
+		return resp, toStatus(fmt.Errorf("%w: %s", ErrGroupNotFound, group))
+	}
+	for key, result := range g.getMultiForPeer(ctx, keys) {
+		item := &pb.BatchGetItem{Key: key}
+		if result.Err != nil {
+			item.Error = result.Err.Error()
+			item.Reason = errorReason(result.Err)
+		} else {
+			item.Value = result.Value.ByteSlice()
+			if expire := result.Value.Expire(); !expire.IsZero() {
+				item.ExpireAt = expire.UnixNano()
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+// rpc方法 将kv写入本节点的缓存 由key的所属节点执行 不再转发
+func (s *server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	group, key := in.GetGroup(), in.GetKey()
+	resp := &pb.SetResponse{}
+
+	if debugEnabled(s.logger) {
+		s.logger.Debug("recv rpc", "method", "Set", "group", group, "key_hash", logger.KeyHash(key))
+	}
+	if key == "" {
+		return resp, toStatus(ErrEmptyKey)
+	}
+	g := GetGroup(group)
+	if g == nil {
+		return resp, toStatus(fmt.Errorf("%w: %s", ErrGroupNotFound, group))
+	}
+	// 其他副本从源数据获取的值带有过期时间 已经过期时不再写入
+	var ttl time.Duration
+	if expireAt := in.GetExpireAt(); expireAt > 0 {
+		if ttl = time.Until(time.Unix(0, expireAt)); ttl <= 0 {
+			return resp, nil
+		}
+	}
+	g.setLocally(key, in.GetValue(), ttl)
+	return resp, nil
+}
+
+// rpc方法 删除本节点缓存中的key 不再转发
+func (s *server) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	group, key := in.GetGroup(), in.GetKey()
+	resp := &pb.DeleteResponse{}
+
+	if debugEnabled(s.logger) {
+		s.logger.Debug("recv rpc", "method", "Delete", "group", group, "key_hash", logger.KeyHash(key))
+	}
+	if key == "" {
+		return resp, toStatus(ErrEmptyKey)
+	}
+	g := GetGroup(group)
+	if g == nil {
+		return resp, toStatus(fmt.Errorf("%w: %s", ErrGroupNotFound, group))
+	}
+	g.removeLocally(key)
+	return resp, nil
+}
+
+// rpc方法 返回本节点上某个group的统计信息
+func (s *server) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	g := GetGroup(in.GetGroup())
+	if g == nil {
+		return &pb.StatsResponse{}, toStatus(fmt.Errorf("%w: %s", ErrGroupNotFound, in.GetGroup()))
+	}
+	stats := g.Stats()
+	return &pb.StatsResponse{
+		Gets:            stats.Gets,
+		LocalHits:       stats.LocalHits,
+		HotHits:         stats.HotHits,
+		NegativeHits:    stats.NegativeHits,
+		PeerLoads:       stats.PeerLoads,
+		PeerErrors:      stats.PeerErrors,
+		RetrieverLoads:  stats.RetrieverLoads,
+		RetrieverErrors: stats.RetrieverErrors,
+		Dedups:          stats.Dedups,
+		Evictions:       stats.Evictions,
+		Bytes:           stats.Bytes,
+		Items:           stats.Items,
+		InFlight:        stats.InFlight,
+		Refreshes:       stats.Refreshes,
+	}, nil
+}
+
+// PeerStats 返回访问每个远程节点的rpc统计信息
+func (s *server) PeerStats() []PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]PeerStats, 0, len(s.clients))
+	for peerAddr, c := range s.clients {
+		if peerAddr == s.addr {
+			continue
+		}
+		stats = append(stats, c.peerStats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Addr < stats[j].Addr })
+	return stats
+}
+
+// ClusterStats 通过 Stats rpc 获取集群中每个节点上某个group的统计信息 key是节点地址
+// 获取失败的节点不包含在结果中 返回遇到的第一个错误
+func (s *server) ClusterStats(ctx context.Context, group string) (map[string]Stats, error) {
+	stats := make(map[string]Stats)
+	if g := GetGroup(group); g != nil {
+		stats[s.addr] = g.Stats()
+	}
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for peerAddr, c := range s.clients {
+		if peerAddr != s.addr {
+			clients = append(clients, c)
+		}
+	}
+	s.mu.Unlock()
+	var firstErr error
+	for _, c := range clients {
+		peerStats, err := c.FetchStats(ctx, group)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		stats[c.name] = peerStats
+	}
+	return stats, firstErr
+}
+
+// Shutdown 优雅地停止server
+// 先从注册中心注销 使其他节点不再选择本节点 然后等待进行中的rpc处理完成 最后关闭与其他节点的连接
+// ctx 结束时不再等待进行中的rpc 直接关闭并返回ctx的错误
+func (s *server) Shutdown(ctx context.Context) error {
+	return s.shutdown(ctx, true)
+}
+
+// Stop 立即停止server 不等待进行中的rpc
 func (s *server) Stop() {
+	s.shutdown(context.Background(), false)
+}
+
+func (s *server) shutdown(ctx context.Context, graceful bool) error {
+	return s.stop(ctx, graceful, true)
+}
+
+// 停止server wait为false时不等待rpc服务退出 用于rpc服务自己异常退出时
+func (s *server) stop(ctx context.Context, graceful bool, wait bool) error {
 	s.mu.Lock()
 	if !s.status {
 		s.mu.Unlock()
-		return
+		return nil
 	}
-	s.stopSignal <- nil // 发送停止keepalive信号
-	s.status = false    // 设置server运行状态为stop
-	s.clients = nil     // 清空客户端信息 有助于垃圾回收
-	s.consHash = nil    // 清空一致性哈希信息 有助于垃圾回收
+	s.status = false // 设置server运行状态为stop
+	s.stopping = true
+	s.stopWatch() // 停止监听节点变化
+	s.stopMetrics()
+	grpcServer, done := s.grpcServer, s.done
+	s.grpcServer = nil
+	reg, addr := s.registry, s.addr
 	s.mu.Unlock()
+
+	// 从注册中心注销 停止心跳 不持有锁 避免注销较慢时阻塞 Pick 等对hash环的访问
+	regCtx, cancel := s.withRegisterTimeout(ctx)
+	if err := reg.Deregister(regCtx, s.serviceName, addr); err != nil {
+		s.logger.Warn("deregister failed", "addr", addr, "error", err)
+	}
+	cancel()
+
+	// 关闭tcp listen 等待进行中的rpc处理完成 不持有锁 避免阻塞rpc处理中对server的访问
+	var err error
+	if graceful {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+			<-stopped
+			err = ctx.Err()
+		}
+	} else {
+		grpcServer.Stop()
+	}
+	if wait {
+		<-done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopping = false
+	// 自己创建的注册中心在重新启动时重新创建
+	if s.ownRegistry {
+		s.registry.Close()
+		s.registry = nil
+	}
+	// 关闭与其他节点的连接
+	for _, c := range s.clients {
+		c.Close()
+	}
+	s.clients = nil // 清空客户端信息 有助于垃圾回收
+	// 清空hash环上的节点 有助于垃圾回收 保留选择节点的策略以便重新启动
+	if s.consHash != nil {
+		s.consHash.Remove(s.consHash.Peers()...)
+	}
+	s.logger.Info("server stopped", "addr", s.addr)
+	return err
 }
@@ -0,0 +1,528 @@
+package gocache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neijuanxiaozi/gocache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// 启动一个使用内存注册中心的单节点server 并创建注册到该server的group
+func startServer(t *testing.T, addr string, group string) *Group {
+	t.Helper()
+	svr, err := NewServerWithRegistry(addr, registry.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(svr.Stop)
+	g := NewGroup(group, 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	g.RegisterSvr(svr)
+	return g
+}
+
+// 不使用TLS和认证连接节点 用于测试中直接访问server
+func dialInsecure(peerAddr string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(peerAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+func TestServer_RPC(t *testing.T) {
+	addr := "127.0.0.1:16324"
+	startServer(t, addr, "rpc")
+	c := NewClient(addr, dialInsecure)
+	defer c.Close()
+	ctx := context.Background()
+
+	if v, err := c.Fetch(ctx, "rpc", "Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("fetch Tom failed: %v %s", err, v)
+	}
+	if err := c.Set(ctx, "rpc", "Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.BatchFetch(ctx, "rpc", []string{"Tom", "Jack"})
+	if err != nil || results["Tom"].Value.String() != "700" || results["Jack"].Value.String() != "589" {
+		t.Fatalf("batch fetch failed: %v %v", err, results)
+	}
+	if err := c.Delete(ctx, "rpc", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Fetch(ctx, "rpc", "Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("fetch Tom after delete failed: %v %s", err, v)
+	}
+	if _, err := c.Fetch(ctx, "missing", "Tom"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("fetch from missing group: %v, want ErrGroupNotFound", err)
+	}
+	if err := c.Set(ctx, "rpc", "", []byte("1")); !errors.Is(err, ErrEmptyKey) {
+		t.Fatalf("set empty key: %v, want ErrEmptyKey", err)
+	}
+
+	// Tom: 源数据 -> 删除后源数据 Jack: 源数据 共获取3次源数据
+	stats, err := c.FetchStats(ctx, "rpc")
+	if err != nil || stats.Gets != 4 || stats.LocalHits != 1 || stats.RetrieverLoads != 3 {
+		t.Fatalf("stats = %+v, %v", stats, err)
+	}
+	peer := c.peerStats()
+	if get := peer.Methods["Get"]; get.Requests != 3 || get.Errors != 1 || get.Latency.Count != 3 {
+		t.Errorf("Get rpc stats = %+v", get)
+	}
+	if codes := peer.Methods["Get"].Codes; codes["NotFound"].Count != 1 {
+		t.Errorf("Get rpc codes = %v", codes)
+	}
+
+	// 没有节点监听的地址
+	down := NewClient("127.0.0.1:16334", dialInsecure)
+	defer down.Close()
+	if _, err := down.Fetch(ctx, "rpc", "Tom"); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("fetch from down peer: %v, want ErrPeerUnavailable", err)
+	}
+}
+
+// 第一次监听的管道立即关闭 模拟etcd压缩或连接出错
+type flakyWatchRegistry struct {
+	*registry.Memory
+	watches atomic.Int32
+}
+
+func (r *flakyWatchRegistry) Watch(ctx context.Context, service string) (<-chan []registry.Endpoint, error) {
+	if r.watches.Add(1) == 1 {
+		ch := make(chan []registry.Endpoint)
+		close(ch)
+		return ch, nil
+	}
+	return r.Memory.Watch(ctx, service)
+}
+
+// 监听的管道被关闭后重新监听 节点变化依然生效
+func TestServer_Rewatch(t *testing.T) {
+	addr := "127.0.0.1:16339"
+	reg := &flakyWatchRegistry{Memory: registry.NewMemory()}
+	svr, err := NewServerWithRegistry(addr, reg, WithMembershipDebounce(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	reg.Register(context.Background(), defaultServiceName, registry.Endpoint{Addr: "127.0.0.1:16340"})
+	waitFor(t, func() bool { return len(svr.PickAll()) == 1 })
+	if n := reg.watches.Load(); n < 2 {
+		t.Fatalf("watch called %d times, want a retry", n)
+	}
+}
+
+func TestServer_Membership(t *testing.T) {
+	addr := "127.0.0.1:16325"
+	reg := registry.NewMemory()
+	svr, err := NewServerWithRegistry(addr, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 2)
+	svr.OnMembershipChange(func(added, removed []string) {
+		changes <- append(added, removed...)
+	})
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	if got := <-changes; len(got) != 1 || got[0] != addr {
+		t.Fatalf("Actual: %v\tExpect: [%s]", got, addr)
+	}
+	// 新节点加入注册中心后 hash环自动更新
+	reg.Register(context.Background(), defaultServiceName, registry.Endpoint{Addr: "127.0.0.1:16326"})
+	if got := <-changes; len(got) != 1 || got[0] != "127.0.0.1:16326" {
+		t.Fatalf("Actual: %v\tExpect: [127.0.0.1:16326]", got)
+	}
+	if len(svr.PickAll()) != 1 {
+		t.Fatalf("Actual: %d\tExpect: %d", len(svr.PickAll()), 1)
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	addr := "127.0.0.1:16331"
+	reg := registry.NewMemory()
+	svr, err := NewServerWithRegistry(addr, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("shutdown", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte(db[key]), nil
+	}))
+	defer g.Close()
+
+	c := NewClient(addr, dialInsecure)
+	defer c.Close()
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := c.Fetch(context.Background(), "shutdown", "Tom")
+		fetched <- err
+	}()
+	<-started
+	stopped := make(chan error, 1)
+	go func() { stopped <- svr.Shutdown(context.Background()) }()
+	// 先从注册中心注销 再等待进行中的rpc
+	for {
+		eps, _ := reg.Resolve(context.Background(), defaultServiceName)
+		if len(eps) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	if err := <-fetched; err != nil {
+		t.Fatalf("in-flight rpc should complete: %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 注册总是失败的注册中心
+type failingRegistry struct {
+	*registry.Memory
+}
+
+func (r failingRegistry) Register(ctx context.Context, service string, ep registry.Endpoint) error {
+	return errors.New("registry unavailable")
+}
+
+// 注册失败时不改变公布地址 重试时仍能正确识别自己
+func TestServer_RegisterFailureKeepsAddr(t *testing.T) {
+	svr, err := NewServerWithRegistry("localhost:0", failingRegistry{registry.NewMemory()}, WithListenAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers("localhost:0", "127.0.0.1:16341")
+	if err := svr.Start(context.Background()); err == nil {
+		t.Fatal("Start should fail when register fails")
+	}
+	if addr := svr.Addr(); addr != "localhost:0" {
+		t.Fatalf("Addr() = %s after failed start, want localhost:0", addr)
+	}
+	if peers := svr.PickAll(); len(peers) != 1 {
+		t.Fatalf("PickAll() = %d peers, want 1", len(peers))
+	}
+}
+
+func TestServer_EphemeralPort(t *testing.T) {
+	reg := registry.NewMemory()
+	svr, err := NewServerWithRegistry("localhost:0", reg, WithListenAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers("localhost:0")
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	addr := svr.Addr()
+	if addr == "localhost:0" || !strings.HasPrefix(addr, "localhost:") {
+		t.Fatalf("Addr() = %s, expect localhost with the bound port", addr)
+	}
+	if !strings.HasSuffix(svr.ListenAddr(), addr[len("localhost"):]) {
+		t.Fatalf("ListenAddr() = %s, Addr() = %s, ports should match", svr.ListenAddr(), addr)
+	}
+	eps, _ := reg.Resolve(context.Background(), defaultServiceName)
+	if len(eps) != 1 || eps[0].Addr != addr {
+		t.Fatalf("registered %v, expect %s", eps, addr)
+	}
+	if peers := svr.consHash.Peers(); len(peers) != 1 || peers[0] != addr {
+		t.Fatalf("ring peers %v, expect [%s]", peers, addr)
+	}
+}
+
+// 生成127.0.0.1的自签名证书 同时作为CA
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	addr := "127.0.0.1:16332"
+	cert, pool := selfSignedCert(t)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	clientTLS := &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}
+	svr, err := NewServerWithRegistry(addr, registry.NewMemory(), WithTLSConfig(serverTLS, clientTLS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	g := NewGroup("tls", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	defer g.Close()
+
+	c := NewClient(addr, svr.dial)
+	defer c.Close()
+	if v, err := c.Fetch(context.Background(), "tls", "Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("fetch over mTLS failed: %v %s", err, v)
+	}
+	plain := NewClient(addr, dialInsecure)
+	defer plain.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := plain.Fetch(ctx, "tls", "Tom"); err == nil {
+		t.Fatalf("plaintext client should be rejected")
+	}
+	if _, err := NewServerWithRegistry(addr, registry.NewMemory(), WithTLSConfig(serverTLS, nil)); err == nil {
+		t.Fatalf("server tls without client tls should be rejected")
+	}
+}
+
+// 有界负载时本节点自己的获取也计入负载 读请求溢出后 写入和删除仍然到达所属节点
+func TestServer_BoundedLoadSpill(t *testing.T) {
+	self, other := "127.0.0.1:16335", "127.0.0.1:16336"
+	svr, err := NewServerWithRegistry(self, registry.NewMemory(), WithBoundedLoad(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(self, other)
+	// 找到属于本节点的两个key和属于另一个节点的key
+	var block, mine, theirs string
+	for i := 0; block == "" || mine == "" || theirs == ""; i++ {
+		key := strconv.Itoa(i)
+		if _, remote := svr.Pick(key); remote {
+			theirs = key
+		} else if block == "" {
+			block = key
+		} else {
+			mine = key
+		}
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	var spillLoads atomic.Int32
+	g := NewGroup("spill", 2<<10, RetrieverFunc(func(key string) ([]byte, error) {
+		if key == theirs {
+			spillLoads.Add(1)
+		}
+		if key == block {
+			entered <- struct{}{}
+			<-release
+		}
+		return []byte(key), nil
+	}))
+	defer g.Close()
+	g.RegisterSvr(svr)
+
+	go g.Get(block)
+	<-entered
+	defer close(release)
+	if _, remote := svr.Pick(mine); !remote {
+		t.Fatalf("read of %s should spill while this node is loaded", mine)
+	}
+	// 另一个节点没有启动 写入被发往它时会失败
+	if err := g.Set(mine, []byte("v")); err != nil {
+		t.Fatalf("set during spill: %v", err)
+	}
+	if v, ok := g.cache.get(mine); !ok || v.String() != "v" {
+		t.Fatalf("set should reach the owner, got %q %v", v, ok)
+	}
+	if err := g.Delete(mine); err != nil {
+		t.Fatalf("delete during spill: %v", err)
+	}
+	if _, ok := g.cache.get(mine); ok {
+		t.Fatalf("delete should reach the owner")
+	}
+
+	// 溢出到本节点的请求不放入主缓存 短时间内重复的请求由热点缓存返回 不再访问源数据
+	for i := 0; i < 5; i++ {
+		if v, err := g.getForPeer(context.Background(), theirs); err != nil || v.String() != theirs {
+			t.Fatalf("get spilled key: %v %s", err, v)
+		}
+	}
+	results := g.getMultiForPeer(context.Background(), []string{theirs})
+	if r := results[theirs]; r.Err != nil || r.Value.String() != theirs {
+		t.Fatalf("batch get spilled key: %v", r)
+	}
+	if n := spillLoads.Load(); n != 1 {
+		t.Fatalf("spilled key retrieved %d times, want 1", n)
+	}
+	if _, ok := g.cache.get(theirs); ok {
+		t.Fatalf("spilled key %s should not be cached on a non-owner", theirs)
+	}
+	if v, ok := g.hotCache.get(theirs); !ok || time.Until(v.Expire()) > defaultSpillTTL {
+		t.Fatalf("spilled key %s should be kept briefly in the hot cache", theirs)
+	}
+}
+
+// 注销时阻塞直到release关闭
+type slowDeregistry struct {
+	*registry.Memory
+	deregistering chan struct{}
+	release       chan struct{}
+}
+
+func (r *slowDeregistry) Deregister(ctx context.Context, service string, addr string) error {
+	close(r.deregistering)
+	<-r.release
+	return r.Memory.Deregister(ctx, service, addr)
+}
+
+func TestServer_DeregisterUnlocked(t *testing.T) {
+	addr := "127.0.0.1:16337"
+	reg := &slowDeregistry{Memory: registry.NewMemory(), deregistering: make(chan struct{}), release: make(chan struct{})}
+	svr, err := NewServerWithRegistry(addr, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- svr.Shutdown(context.Background()) }()
+	<-reg.deregistering
+
+	// 注销较慢时 不阻塞对hash环的访问 也不能在停止完成前重新启动
+	picked := make(chan struct{})
+	go func() {
+		svr.Pick("Tom")
+		svr.PickReplicas("Tom", 2)
+		close(picked)
+	}()
+	select {
+	case <-picked:
+	case <-time.After(time.Second):
+		t.Fatal("Pick blocked while deregistering")
+	}
+	if err := svr.Start(context.Background()); err == nil {
+		t.Fatal("Start should fail while stopping")
+	}
+	close(reg.release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+
+	// 停止后可以重新启动
+	reg.deregistering = make(chan struct{})
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svr.Stop()
+}
+
+// 调用者的截止时间经过rpc和 singleflight 传递到远程节点的回调函数
+func TestServer_DeadlinePropagation(t *testing.T) {
+	addr := "127.0.0.1:16338"
+	svr, err := NewServerWithRegistry(addr, registry.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.SetPeers(addr)
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Stop()
+	remaining := make(chan time.Duration, 1)
+	g := NewGroup("deadline", 2<<10, RetrieverFuncCtx(func(ctx context.Context, key string) ([]byte, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			remaining <- -1
+		} else {
+			remaining <- time.Until(deadline)
+		}
+		return []byte(db[key]), nil
+	}))
+	defer g.Close()
+	g.RegisterSvr(svr)
+
+	c := NewClient(addr, dialInsecure)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Fetch(ctx, "deadline", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if d := <-remaining; d <= 0 || d > 50*time.Millisecond {
+		t.Fatalf("retriever deadline in %v, want within the caller's 50ms", d)
+	}
+}
+
+// rpc服务异常退出时 server停止并从注册中心注销
+func TestServer_ServeFailure(t *testing.T) {
+	var lis net.Listener
+	listen = func(network, address string) (net.Listener, error) {
+		l, err := net.Listen(network, address)
+		lis = l
+		return l, err
+	}
+	defer func() { listen = net.Listen }()
+
+	addr := "127.0.0.1:16342"
+	reg := registry.NewMemory()
+	svr, err := NewServerWithRegistry(addr, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	if err := svr.Wait(); err == nil {
+		t.Fatal("Wait should return the serve error")
+	}
+	if eps, _ := reg.Resolve(context.Background(), defaultServiceName); len(eps) != 0 {
+		t.Fatalf("failed server should be deregistered: %v", eps)
+	}
+	// 已经停止 可以重新启动
+	listen = net.Listen
+	if err := svr.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svr.Stop()
+}
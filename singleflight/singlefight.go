@@ -1,52 +1,214 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
 
-// call代表正在进行中 或已经结束的请求 使用sync.WaitGroup锁避免重入
+// call代表正在进行中 或已经结束的请求 使用done管道通知等待者请求已结束
 type packet struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int                // 仍在等待结果的调用者个数 由Flight.mu保护
+	cancel  context.CancelFunc // 所有调用者都放弃等待时取消fn
+	expired bool               // fn结束时共享的ctx已经超过发起者的截止时间
 }
 
 // Group是singleflight的主数据结构 管理不同key的请求(call)
 type Flight struct {
 	mu     sync.Mutex         // 保护Group成员变量m并发读写而加上的锁
 	flight map[string]*packet // 一个key对应一个请求 发起请求时就插入到map中 后续相同的请求到来时 发现map中有就等待map中请求返回 避免重复发送
+	dups   atomic.Int64       // 等待已存在请求结果的次数 即被合并掉的重复请求个数
 }
 
 // 对Group 实现do方法 不论Do被调用多少次 传入的fn都只会被调用一次 等待fn调用结束了 返回返回值或者错误
-func (f *Flight) Fly(key string, fn func() (interface{}, error)) (interface{}, error) {
+// fn 在独立的协程中执行 使用的ctx保留第一个调用者ctx中的值和截止时间 但不随任何一个调用者的ctx取消
+// 每个调用者在自己的ctx结束时不再等待 直接返回ctx的错误 所有调用者都放弃等待后fn的ctx才被取消
+// 因此第一个调用者取消时 其他仍在等待的调用者依然可以拿到结果
+// 第一个调用者的截止时间早于其他调用者时 fn因超时失败后 仍未超时的调用者重新发起请求 使用自己的截止时间
+func (f *Flight) Fly(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		val, expired, err := f.fly(ctx, key, fn)
+		if expired && ctx.Err() == nil {
+			continue
+		}
+		return val, err
+	}
+}
+
+// 创建fn使用的共享ctx 保留ctx中的值和截止时间 不随ctx取消
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	base := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(base, deadline)
+	}
+	return context.WithCancel(base)
+}
+
+// 执行一次 Fly expired为true时表示fn因共享ctx超过截止时间而结束
+func (f *Flight) fly(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, bool, error) {
 	f.mu.Lock()
 	//	Group里的map结构延迟初始化
 	if f.flight == nil {
 		f.flight = make(map[string]*packet)
 	}
 	// 如果对应key的请求已经存在还未返回
-	if p, ok := f.flight[key]; ok {
+	p, ok := f.flight[key]
+	if ok {
+		p.waiters++
 		f.mu.Unlock()
-		// 阻塞知道锁被释放  可以等待已经存在请求的结果 不必重复请求
-		p.wg.Wait()
-		return p.val, p.err
-	}
-	//没有key对应的请求
-
-	//新建一个请求
-	p := new(packet)
-	//锁加1
-	p.wg.Add(1)
-	//将对应key的请求插入到map中
-	f.flight[key] = p
-	f.mu.Unlock()
-	//发起请求
-	p.val, p.err = fn()
-	//请求结束 唤醒其他所有等待这个请求的协程
-	p.wg.Done()
+		f.dups.Add(1)
+	} else {
+		//没有key对应的请求 新建一个请求 并将对应key的请求插入到map中
+		fctx, cancel := detach(ctx)
+		p = &packet{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		f.flight[key] = p
+		f.mu.Unlock()
+		//发起请求
+		go f.run(fctx, key, p, fn)
+	}
+	// 阻塞直到请求结束或ctx结束  可以等待已经存在请求的结果 不必重复请求
+	select {
+	case <-p.done:
+		return p.val, p.expired, p.err
+	case <-ctx.Done():
+		f.leave(key, p)
+		return nil, false, ctx.Err()
+	}
+}
 
+// 执行fn 结束后唤醒所有等待这个请求的协程
+func (f *Flight) run(ctx context.Context, key string, p *packet, fn func(ctx context.Context) (interface{}, error)) {
+	defer p.cancel()
+	p.val, p.err = fn(ctx)
+	p.expired = errors.Is(ctx.Err(), context.DeadlineExceeded)
 	//请求已经结束 将map中key对应的请求删除
 	f.mu.Lock()
-	delete(f.flight, key)
+	if f.flight[key] == p {
+		delete(f.flight, key)
+	}
+	f.mu.Unlock()
+	//唤醒其他所有等待这个请求的协程
+	close(p.done)
+}
+
+// 调用者放弃等待 最后一个调用者离开时取消fn 并从map中删除 之后相同的请求重新发起
+func (f *Flight) leave(key string, p *packet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p.waiters--
+	if p.waiters > 0 {
+		return
+	}
+	p.cancel()
+	if f.flight[key] == p {
+		delete(f.flight, key)
+	}
+}
+
+// Result 是 FlyMulti 中单个key的结果
+type Result struct {
+	Val interface{}
+	Err error
+}
+
+// FlyMulti 批量版本的 Fly keys中已有请求进行中的key等待该请求的结果 其余key合并为一次fn调用
+// fn返回每个key的结果 没有返回结果的key视为值为nil 在fn执行期间 相同key的 Fly 和 FlyMulti 会等待这次调用
+// 与 Fly 相同 fn在独立的协程中执行 所有等待这次调用的调用者都放弃等待后fn的ctx才被取消
+// 因其他调用者的截止时间失败的key 在ctx结束前重新获取
+func (f *Flight) FlyMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) map[string]Result) map[string]Result {
+	results, expired := f.flyMulti(ctx, keys, fn)
+	for len(expired) > 0 && ctx.Err() == nil {
+		var retried map[string]Result
+		retried, expired = f.flyMulti(ctx, expired, fn)
+		for key, r := range retried {
+			results[key] = r
+		}
+	}
+	return results
+}
+
+// 执行一次 FlyMulti 同时返回因共享ctx超过截止时间而失败的key
+func (f *Flight) flyMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) map[string]Result) (map[string]Result, []string) {
+	f.mu.Lock()
+	if f.flight == nil {
+		f.flight = make(map[string]*packet)
+	}
+	packets := make(map[string]*packet, len(keys))
+	var claimed []string
+	fctx, cancel := detach(ctx)
+	var abandoned atomic.Int64 // 已经没有调用者等待的packet个数 全部放弃时取消fn
+	for _, key := range keys {
+		if _, ok := packets[key]; ok {
+			continue
+		}
+		if p, ok := f.flight[key]; ok {
+			p.waiters++
+			f.dups.Add(1)
+			packets[key] = p
+			continue
+		}
+		p := &packet{done: make(chan struct{}), waiters: 1, cancel: func() {
+			if abandoned.Add(1) == int64(len(claimed)) {
+				cancel()
+			}
+		}}
+		f.flight[key] = p
+		packets[key] = p
+		claimed = append(claimed, key)
+	}
 	f.mu.Unlock()
-	//返回结果
-	return p.val, p.err
+	if len(claimed) > 0 {
+		go func() {
+			defer cancel()
+			results := fn(fctx, claimed)
+			expired := errors.Is(fctx.Err(), context.DeadlineExceeded)
+			f.mu.Lock()
+			for _, key := range claimed {
+				p := packets[key]
+				p.val, p.err, p.expired = results[key].Val, results[key].Err, expired
+				if f.flight[key] == p {
+					delete(f.flight, key)
+				}
+			}
+			f.mu.Unlock()
+			for _, key := range claimed {
+				close(packets[key].done)
+			}
+		}()
+	} else {
+		cancel()
+	}
+
+	// 等待每个key的结果 ctx结束时放弃所有还未结束的key
+	results := make(map[string]Result, len(packets))
+	var expired []string
+	for key, p := range packets {
+		select {
+		case <-p.done:
+			results[key] = Result{Val: p.val, Err: p.err}
+			if p.expired {
+				expired = append(expired, key)
+			}
+		case <-ctx.Done():
+			f.leave(key, p)
+			results[key] = Result{Err: ctx.Err()}
+		}
+	}
+	return results, expired
+}
+
+// Dups 返回被合并掉的重复请求个数
+func (f *Flight) Dups() int64 {
+	return f.dups.Load()
+}
+
+// InFlight 返回正在进行中的请求个数
+func (f *Flight) InFlight() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.flight)
 }
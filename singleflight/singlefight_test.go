@@ -0,0 +1,149 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 第一个调用者取消后 仍在等待的调用者依然拿到结果
+func TestFly_LeaderCanceled(t *testing.T) {
+	var f Flight
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return "630", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := f.Fly(leaderCtx, "Tom", fn)
+		leaderErr <- err
+	}()
+	<-started
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+	follower := make(chan result, 1)
+	go func() {
+		v, err := f.Fly(context.Background(), "Tom", fn)
+		follower <- result{v, err}
+	}()
+	for f.Dups() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader err = %v, want canceled", err)
+	}
+	close(release)
+	if r := <-follower; r.err != nil || r.v != "630" {
+		t.Fatalf("follower = %v %v, want 630", r.v, r.err)
+	}
+}
+
+// 所有调用者都放弃等待时取消fn
+func TestFly_AllCanceled(t *testing.T) {
+	var f Flight
+	canceled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		f.Fly(ctx, "Tom", func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		})
+	}()
+	for f.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("fn should be canceled after all callers leave")
+	}
+}
+
+// 正在进行中的key等待已有的请求 其余key合并为一次调用
+func TestFlyMulti(t *testing.T) {
+	var f Flight
+	release := make(chan struct{})
+	go f.Fly(context.Background(), "Tom", func(ctx context.Context) (interface{}, error) {
+		<-release
+		return "630", nil
+	})
+	for f.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var batched []string
+	done := make(chan map[string]Result, 1)
+	go func() {
+		done <- f.FlyMulti(context.Background(), []string{"Tom", "Jack", "Jack"}, func(ctx context.Context, keys []string) map[string]Result {
+			batched = keys
+			return map[string]Result{"Jack": {Val: "589"}}
+		})
+	}()
+	for f.Dups() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	results := <-done
+	if len(batched) != 1 || batched[0] != "Jack" {
+		t.Fatalf("batched keys = %v, want [Jack]", batched)
+	}
+	if results["Tom"].Val != "630" || results["Jack"].Val != "589" {
+		t.Fatalf("FlyMulti = %v", results)
+	}
+}
+
+// fn使用第一个调用者的截止时间 超时后截止时间更晚的调用者重新发起
+func TestFly_Deadline(t *testing.T) {
+	var f Flight
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("deadline not propagated")
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return "630", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	leaderCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := f.Fly(leaderCtx, "Tom", fn)
+		leaderErr <- err
+	}()
+	for f.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if v, err := f.Fly(ctx, "Tom", fn); err != nil || v != "630" {
+		t.Fatalf("follower = %v %v, want 630", v, err)
+	}
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("leader err = %v, want deadline exceeded", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("fn called %d times, want 2", n)
+	}
+}
@@ -0,0 +1,184 @@
+package gocache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stats 是 Group 统计信息的快照
+type Stats struct {
+	Gets            int64 // Get请求次数 包括其他节点发来的请求
+	LocalHits       int64 // 主缓存命中次数
+	HotHits         int64 // 热点缓存命中次数
+	NegativeHits    int64 // 墓碑命中次数 即直接返回 ErrNotFound 的次数
+	Misses          int64 // 主缓存 热点缓存和墓碑都未命中的次数
+	PeerLoads       int64 // 从远程节点成功获取的次数
+	PeerErrors      int64 // 从远程节点获取失败的次数
+	RetrieverLoads  int64 // 调用回调函数获取源数据的次数
+	RetrieverErrors int64 // 回调函数返回错误的次数
+	Dedups          int64 // 被singleflight合并掉的重复请求次数
+	Evictions       int64 // 主缓存 热点缓存和墓碑缓存因容量不足淘汰的key个数
+	Bytes           int64 // 主缓存 热点缓存和墓碑缓存当前使用的内存
+	Items           int64 // 主缓存 热点缓存和墓碑缓存当前缓存的key个数
+	InFlight        int64 // 正在进行中的singleflight请求个数
+	Refreshes       int64 // 命中变旧或即将过期的值时发起的后台刷新次数
+}
+
+// Group 内部的统计计数器 使用原子操作 不需要加锁
+type groupStats struct {
+	gets            atomic.Int64
+	localHits       atomic.Int64
+	hotHits         atomic.Int64
+	negativeHits    atomic.Int64
+	misses          atomic.Int64
+	peerLoads       atomic.Int64
+	peerErrors      atomic.Int64
+	retrieverLoads  atomic.Int64
+	retrieverErrors atomic.Int64
+	refreshes       atomic.Int64
+	loadLatency     histogram // 缓存未命中时获取数据的耗时
+}
+
+// Stats 返回 Group 当前的统计信息
+func (g *Group) Stats() Stats {
+	main, hot, neg := g.cache.stats(), g.hotCache.stats(), g.negCache.stats()
+	return Stats{
+		Gets:            g.stats.gets.Load(),
+		LocalHits:       g.stats.localHits.Load(),
+		HotHits:         g.stats.hotHits.Load(),
+		NegativeHits:    g.stats.negativeHits.Load(),
+		Misses:          g.stats.misses.Load(),
+		PeerLoads:       g.stats.peerLoads.Load(),
+		PeerErrors:      g.stats.peerErrors.Load(),
+		RetrieverLoads:  g.stats.retrieverLoads.Load(),
+		RetrieverErrors: g.stats.retrieverErrors.Load(),
+		Dedups:          g.flight.Dups(),
+		Evictions:       main.Evictions + hot.Evictions + neg.Evictions,
+		Bytes:           main.Bytes + hot.Bytes + neg.Bytes,
+		Items:           main.Items + hot.Items + neg.Items,
+		InFlight:        int64(g.flight.InFlight()),
+		Refreshes:       g.stats.refreshes.Load(),
+	}
+}
+
+// LoadLatency 返回缓存未命中时获取数据(从远程节点或本地源)的耗时分布
+func (g *Group) LoadLatency() Histogram {
+	return g.stats.loadLatency.snapshot()
+}
+
+// rpc耗时直方图的桶上界 最后一个桶之外的耗时计入溢出桶
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram 是耗时直方图的快照
+// Counts[i] 是耗时不超过 Bounds[i] 的次数(不累加) Counts 比 Bounds 多一个溢出桶
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Count  int64         // 总次数
+	Sum    time.Duration // 总耗时
+}
+
+// 耗时直方图 使用原子操作记录
+type histogram struct {
+	counts [13]atomic.Int64 // len(latencyBuckets)+1
+	count  atomic.Int64
+	sum    atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	snap := Histogram{
+		Bounds: latencyBuckets,
+		Counts: make([]int64, len(h.counts)),
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+	for i := range h.counts {
+		snap.Counts[i] = h.counts[i].Load()
+	}
+	return snap
+}
+
+// RPCStats 是某个远程节点上某一种rpc的统计信息快照
+type RPCStats struct {
+	Requests int64                // 请求次数
+	Errors   int64                // 失败次数
+	Latency  Histogram            // 耗时分布
+	Codes    map[string]Histogram // 按grpc状态码区分的耗时分布 key是状态码名称 如OK Unavailable
+}
+
+// 单个rpc方法的统计计数器
+type rpcStats struct {
+	requests atomic.Int64
+	errors   atomic.Int64
+	latency  histogram
+	mu       sync.Mutex                // 保护codes
+	codes    map[codes.Code]*histogram // 按状态码区分的耗时 第一次出现某个状态码时创建
+}
+
+func (r *rpcStats) observe(d time.Duration, err error) {
+	r.requests.Add(1)
+	if err != nil {
+		r.errors.Add(1)
+	}
+	r.latency.observe(d)
+	code := status.Code(err)
+	r.mu.Lock()
+	h, ok := r.codes[code]
+	if !ok {
+		if r.codes == nil {
+			r.codes = make(map[codes.Code]*histogram)
+		}
+		h = &histogram{}
+		r.codes[code] = h
+	}
+	r.mu.Unlock()
+	h.observe(d)
+}
+
+func (r *rpcStats) snapshot() RPCStats {
+	stats := RPCStats{
+		Requests: r.requests.Load(),
+		Errors:   r.errors.Load(),
+		Latency:  r.latency.snapshot(),
+		Codes:    make(map[string]Histogram),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for code, h := range r.codes {
+		stats.Codes[code.String()] = h.snapshot()
+	}
+	return stats
+}
+
+// PeerStats 是访问某个远程节点的统计信息快照 Methods 的key是rpc方法名
+type PeerStats struct {
+	Addr    string
+	Methods map[string]RPCStats
+}
@@ -0,0 +1,195 @@
+// Package tlsutil 从证书文件创建节点间和etcd连接使用的 tls.Config 并在证书文件更新后自动重新加载
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 两次检查证书文件是否更新的最小间隔
+const defaultReloadInterval = 10 * time.Second
+
+// Files 是TLS使用的证书文件 均为PEM格式
+type Files struct {
+	CertFile string // 本节点的证书
+	KeyFile  string // 本节点证书的私钥
+	CAFile   string // 验证对端证书的CA证书 为空时使用系统根证书
+	// 为true时服务端要求客户端提供由CAFile签发的证书(mTLS)
+	MutualTLS bool
+	// 检查证书文件是否更新的最小间隔 <=0时使用默认的10秒
+	ReloadInterval time.Duration
+}
+
+// Reloader 持有从文件加载的证书和CA 在握手时按间隔检查文件是否更新 更新后重新加载
+// 重新加载失败时继续使用旧的证书 错误可以通过 Err 获取
+type Reloader struct {
+	files Files
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTime   time.Time // 上次加载时证书文件中最新的修改时间
+	lastCheck time.Time
+	err       error
+}
+
+// NewReloader 加载证书文件 文件不存在或格式错误时返回错误
+func NewReloader(files Files) (*Reloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("tls cert file and key file are required")
+	}
+	if files.MutualTLS && files.CAFile == "" {
+		return nil, errors.New("mutual tls requires a ca file")
+	}
+	if files.ReloadInterval <= 0 {
+		files.ReloadInterval = defaultReloadInterval
+	}
+	r := &Reloader{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 立即重新加载证书文件
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return r.setErr(err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return r.setErr(fmt.Errorf("load tls key pair failed: %v", err))
+	}
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		pem, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return r.setErr(fmt.Errorf("read ca file failed: %v", err))
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return r.setErr(fmt.Errorf("no certificate found in ca file %s", r.files.CAFile))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime, r.err = &cert, pool, modTime, nil
+	return nil
+}
+
+// Err 返回最近一次重新加载的错误 加载成功时返回nil
+func (r *Reloader) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+func (r *Reloader) setErr(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	return err
+}
+
+// 返回证书文件中最新的修改时间
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// 距离上次检查超过间隔时 检查文件是否更新 更新则重新加载
+func (r *Reloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < r.files.ReloadInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	loaded := r.modTime
+	r.mu.Unlock()
+	if modTime, err := r.latestModTime(); err != nil || modTime.After(loaded) {
+		r.Reload()
+	}
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig 返回服务端使用的 tls.Config 每次握手时使用最新的证书
+// MutualTLS 为true时要求并验证客户端证书
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			// 返回的配置替代grpc在基础配置上设置的NextProtos 需要自己声明h2 否则新版grpc客户端拒绝连接
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"},
+			}
+			if r.files.MutualTLS {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig 返回客户端使用的 tls.Config 每次握手时使用最新的证书和CA验证服务端
+// 服务端证书需要与连接的主机名匹配
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		// CA可能被重新加载 不能使用固定的RootCAs 关闭内置验证 在 VerifyConnection 中用最新的CA验证
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyServer(cs, pool)
+		},
+	}
+}
+
+// 用pool验证服务端证书链和主机名 pool为nil时使用系统根证书
+func verifyServer(cs tls.ConnectionState, pool *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server did not provide a certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
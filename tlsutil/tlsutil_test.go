@@ -0,0 +1,147 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 生成证书 parent为nil时生成自签名的CA证书
+func genCert(t *testing.T, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gocache"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 握手并返回服务端证书的序列号
+func handshake(t *testing.T, server, client *tls.Config) (int64, error) {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	cfg := client.Clone()
+	cfg.ServerName = "localhost"
+	conn, err := tls.Dial("tcp", lis.Addr().String(), cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	// TLS1.3中客户端证书在客户端握手完成后才被服务端验证 读取一次以得到服务端的验证结果
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey, caPEM, _ := genCert(t, 1, nil, nil)
+	_, _, certPEM, keyPEM := genCert(t, 2, caCert, caKey)
+	files := Files{
+		CertFile:       filepath.Join(dir, "cert.pem"),
+		KeyFile:        filepath.Join(dir, "key.pem"),
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		MutualTLS:      true,
+		ReloadInterval: time.Millisecond,
+	}
+	writeFile(t, files.CAFile, caPEM)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+
+	r, err := NewReloader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial, err := handshake(t, r.ServerConfig(), r.ClientConfig()); err != nil || serial != 2 {
+		t.Fatalf("mTLS handshake: serial=%d err=%v", serial, err)
+	}
+	// 每次握手返回的配置需要声明h2 grpc客户端要求ALPN协商出h2
+	cfg, err := r.ServerConfig().GetConfigForClient(nil)
+	if err != nil || len(cfg.NextProtos) != 1 || cfg.NextProtos[0] != "h2" {
+		t.Fatalf("server config: %v %v, want NextProtos [h2]", cfg, err)
+	}
+	// 客户端没有证书时 服务端拒绝连接
+	noCert := r.ClientConfig()
+	noCert.GetClientCertificate = nil
+	if _, err := handshake(t, r.ServerConfig(), noCert); err == nil {
+		t.Fatalf("handshake without client certificate should fail")
+	}
+
+	// 更新证书文件后自动使用新证书
+	_, _, certPEM, keyPEM = genCert(t, 3, caCert, caKey)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(files.CertFile, future, future)
+	time.Sleep(2 * time.Millisecond)
+	if serial, err := handshake(t, r.ServerConfig(), r.ClientConfig()); err != nil || serial != 3 {
+		t.Fatalf("after reload: serial=%d err=%v", serial, err)
+	}
+
+	// 不是该CA签发的服务端证书被拒绝
+	otherCA, otherKey, _, _ := genCert(t, 4, nil, nil)
+	_, _, certPEM, keyPEM = genCert(t, 5, otherCA, otherKey)
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handshake(t, r.ServerConfig(), r.ClientConfig()); err == nil {
+		t.Fatalf("certificate from another ca should be rejected")
+	}
+}
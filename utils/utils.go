@@ -1,35 +1,68 @@
 package utils
 
 import (
-	"fmt"
 	"net"
 	"strconv"
+	"strings"
 )
 
+// ValidPeerAddr 判断addr是否是可以访问的节点地址 host:port
+// host 可以是IPv4地址 方括号括起来的IPv6地址(如[::1]:6324) 或主机名 port 必须在1-65535之间
 func ValidPeerAddr(addr string) bool {
+	host, port, ok := splitAddr(addr)
+	return ok && ValidHost(host) && port > 0
+}
+
+// ValidAdvertiseAddr 判断addr是否可以作为server对外公布的地址
+// 与 ValidPeerAddr 相同 但允许端口为0 表示使用监听时系统分配的端口
+func ValidAdvertiseAddr(addr string) bool {
+	host, _, ok := splitAddr(addr)
+	return ok && ValidHost(host)
+}
+
+// ValidListenAddr 判断addr是否可以作为监听地址 host为空时监听所有网卡 端口为0时由系统分配
+func ValidListenAddr(addr string) bool {
+	host, _, ok := splitAddr(addr)
+	return ok && (host == "" || ValidHost(host))
+}
+
+// ValidHost 判断host是否是IP地址或合法的主机名
+func ValidHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	return validHostname(host)
+}
+
+// 拆分host和port 端口不是0-65535之间的数字时返回false
+func splitAddr(addr string) (string, int, bool) {
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
-		fmt.Println("Error splitting host and port:", err)
-		return false
+		return "", 0, false
 	}
-
-	// Validate the IP address
-	ip := net.ParseIP(host)
-	if ip == nil {
-		fmt.Println("Invalid IP address:", host)
-		return false
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, false
 	}
+	return host, port, true
+}
 
-	// Validate the port
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		fmt.Println("Error converting port:", err)
+// 按RFC 1123判断主机名 由点分隔的标签组成 每个标签1-63个字母 数字或连字符 不能以连字符开头或结尾
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
 		return false
 	}
-	if port < 0 || port > 65535 {
-		fmt.Println("Port out of range:", port)
-		return false
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
 	}
-
 	return true
 }
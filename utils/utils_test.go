@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestValidPeerAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:6324":                     true,
+		"[::1]:6324":                         true,
+		"gocache-0.gocache.default.svc:6324": true,
+		"localhost:6324":                     true,
+		"::1:6324":                           false,
+		"127.0.0.1":                          false,
+		"127.0.0.1:0":                        false,
+		"127.0.0.1:65536":                    false,
+		":6324":                              false,
+		"-bad.example:6324":                  false,
+		"bad_host:6324":                      false,
+	}
+	for addr, expect := range tests {
+		if ValidPeerAddr(addr) != expect {
+			t.Errorf("ValidPeerAddr(%q) Actual: %v\tExpect: %v", addr, !expect, expect)
+		}
+	}
+	if !ValidAdvertiseAddr("127.0.0.1:0") || ValidAdvertiseAddr(":0") {
+		t.Errorf("advertise address allows port 0 but requires a host")
+	}
+	if !ValidListenAddr(":0") || !ValidListenAddr("[::]:6324") {
+		t.Errorf("listen address allows empty host and port 0")
+	}
+}